@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"strconv"
+	"time"
 )
 
 type Attachment struct {
@@ -38,15 +40,185 @@ func (c *Client) ShowAttachment(ctx context.Context, id string) (*Attachment, er
 
 var uploadClient = &http.Client{}
 
+type (
+	uploadOptions struct {
+		progress      func(uploaded, total int64)
+		retries       int
+		retryInterval time.Duration
+	}
+
+	// UploadOption customizes uploading attachments
+	UploadOption func(opts *uploadOptions)
+)
+
+// WithUploadProgress reports the uploaded bytes, total is -1 if the size is unknown
+func WithUploadProgress(fn func(uploaded, total int64)) UploadOption {
+	return func(opts *uploadOptions) {
+		opts.progress = fn
+	}
+}
+
+// WithUploadRetry retries failed uploads, the content is uploaded
+// again only if the reader is an io.Seeker
+func WithUploadRetry(retries int, interval time.Duration) UploadOption {
+	return func(opts *uploadOptions) {
+		opts.retries = retries
+		opts.retryInterval = interval
+	}
+}
+
+type progressReader struct {
+	io.Reader
+	read     int64
+	total    int64
+	progress func(uploaded, total int64)
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.read += int64(n)
+		r.progress(r.read, r.total)
+	}
+
+	return n, err
+}
+
 func UploadAttachmentTo(ctx context.Context, uploadURL string, file []byte) error {
-	req, err := http.NewRequest("PUT", uploadURL, bytes.NewReader(file))
+	return UploadAttachmentReaderTo(ctx, uploadURL, bytes.NewReader(file), int64(len(file)))
+}
+
+func UploadAttachment(ctx context.Context, attachment *Attachment, file []byte) error {
+	return UploadAttachmentTo(ctx, attachment.UploadURL, file)
+}
+
+// UploadAttachmentReader streams the content of r to the attachment
+func UploadAttachmentReader(ctx context.Context, attachment *Attachment, r io.Reader, size int64, opts ...UploadOption) error {
+	return UploadAttachmentReaderTo(ctx, attachment.UploadURL, r, size, opts...)
+}
+
+// UploadAttachmentReaderTo streams size bytes read from r to uploadURL. The storage
+// requires the content length, r is buffered to a temporary file if size is negative.
+func UploadAttachmentReaderTo(ctx context.Context, uploadURL string, r io.Reader, size int64, opts ...UploadOption) error {
+	if size < 0 {
+		f, n, err := bufferAttachment(r)
+		if err != nil {
+			return err
+		}
+
+		defer removeTempFile(f)
+		r, size = f, n
+	}
+
+	o := newUploadOptions(opts)
+	rewind, err := rewinder(r)
+	if err != nil {
+		return err
+	}
+
+	return o.retry(ctx, rewind, func() error {
+		return uploadAttachment(ctx, uploadURL, r, size, o.progress)
+	})
+}
+
+func newUploadOptions(opts []UploadOption) *uploadOptions {
+	var o uploadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &o
+}
+
+// rewinder returns a func seeking r back to the current offset, or nil if r is not an io.Seeker
+func rewinder(r io.Reader) (func() error, error) {
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return nil, nil
+	}
+
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		_, err := seeker.Seek(offset, io.SeekStart)
+		return err
+	}, nil
+}
+
+// retry calls upload until it succeeds or retries run out, it is called only once if rewind is nil
+func (o *uploadOptions) retry(ctx context.Context, rewind func() error, upload func() error) error {
+	for i := 0; ; i++ {
+		err := upload()
+		if err == nil || rewind == nil || i >= o.retries || ctx.Err() != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(o.retryInterval):
+		}
+
+		if err := rewind(); err != nil {
+			return err
+		}
+	}
+}
+
+// bufferAttachment copies the content of unknown size to a temporary file rewound to the
+// start, so it is uploaded with the content length. The file is removed by removeTempFile.
+func bufferAttachment(r io.Reader) (*os.File, int64, error) {
+	f, err := os.CreateTemp("", "mixin-attachment-*")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size, err := io.Copy(f, r)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+
+	if err != nil {
+		removeTempFile(f)
+		return nil, 0, err
+	}
+
+	return f, size, nil
+}
+
+func removeTempFile(f *os.File) {
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+}
+
+func uploadAttachment(ctx context.Context, uploadURL string, r io.Reader, size int64, progress func(uploaded, total int64)) error {
+	// chunked uploads are rejected by the storage
+	if size < 0 {
+		return errors.New("upload attachment: unknown content length")
+	}
+
+	if progress != nil {
+		r = &progressReader{Reader: r, total: size, progress: progress}
+	}
+
+	// make sure the body is not closed by the http client, it is rewound for retries
+	body := io.NopCloser(r)
+	if size == 0 {
+		body = http.NoBody
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", uploadURL, body)
 	if err != nil {
 		return err
 	}
 
 	req.Header.Add("Content-Type", "application/octet-stream")
 	req.Header.Add("x-amz-acl", "public-read")
-	req.Header.Add("Content-Length", strconv.Itoa(len(file)))
+	req.ContentLength = size
+	req.Header.Add("Content-Length", strconv.FormatInt(size, 10))
 
 	resp, err := uploadClient.Do(req)
 	if resp != nil {
@@ -65,6 +237,39 @@ func UploadAttachmentTo(ctx context.Context, uploadURL string, file []byte) erro
 	return nil
 }
 
-func UploadAttachment(ctx context.Context, attachment *Attachment, file []byte) error {
-	return UploadAttachmentTo(ctx, attachment.UploadURL, file)
+// DownloadAttachment streams the content of the attachment, the caller must close the reader
+func (c *Client) DownloadAttachment(ctx context.Context, attachmentID string) (io.ReadCloser, error) {
+	attachment, err := c.ShowAttachment(ctx, attachmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return DownloadAttachmentFrom(ctx, attachment.ViewURL)
+}
+
+// DownloadAttachmentFrom streams the content of the view url, the caller must close the reader
+func DownloadAttachmentFrom(ctx context.Context, viewURL string) (io.ReadCloser, error) {
+	r, _, err := downloadAttachmentFrom(ctx, viewURL)
+	return r, err
+}
+
+// downloadAttachmentFrom is same as DownloadAttachmentFrom but returns the content length too, -1 if unknown
+func downloadAttachmentFrom(ctx context.Context, viewURL string) (io.ReadCloser, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", viewURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := uploadClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.StatusCode >= 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		return nil, 0, errors.New(resp.Status)
+	}
+
+	return resp.Body, resp.ContentLength, nil
 }
@@ -0,0 +1,202 @@
+package mixin
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// Encrypted attachments are laid out as iv | aes-256-cbc ciphertext | hmac-sha256(iv | ciphertext),
+// keys are the aes key followed by the hmac key, and digest is sha256 of the whole encrypted data.
+const (
+	attachmentAESKeySize = 32
+	attachmentMACKeySize = 32
+	attachmentKeysSize   = attachmentAESKeySize + attachmentMACKeySize
+	attachmentMACSize    = sha256.Size
+)
+
+var (
+	ErrInvalidAttachmentKeys    = errors.New("invalid attachment keys")
+	ErrInvalidAttachmentData    = errors.New("invalid attachment data")
+	ErrAttachmentDigestMismatch = errors.New("attachment digest mismatch")
+	ErrAttachmentMACMismatch    = errors.New("attachment mac mismatch")
+)
+
+// EncryptAttachment encrypts data with random keys, the keys and digest should be
+// sent within the attachment message as AttachmentMessageEncrypt
+func EncryptAttachment(data []byte) (encrypted, keys, digest []byte, err error) {
+	r, err := NewAttachmentEncryptReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	encrypted = make([]byte, 0, EncryptedAttachmentSize(int64(len(data))))
+	buf := bytes.NewBuffer(encrypted)
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return buf.Bytes(), r.Keys(), r.Digest(), nil
+}
+
+// EncryptedAttachmentSize returns the size of the encrypted data of size bytes
+func EncryptedAttachmentSize(size int64) int64 {
+	return aes.BlockSize + (size/aes.BlockSize+1)*aes.BlockSize + attachmentMACSize
+}
+
+// AttachmentEncryptReader encrypts the content read from the source on the fly
+type AttachmentEncryptReader struct {
+	src    io.Reader
+	keys   []byte
+	iv     []byte
+	mode   cipher.BlockMode
+	mac    hash.Hash
+	sum    hash.Hash
+	digest []byte
+
+	pending []byte
+	out     bytes.Buffer
+	chunk   []byte
+}
+
+// NewAttachmentEncryptReader encrypts src with random keys
+func NewAttachmentEncryptReader(src io.Reader) (*AttachmentEncryptReader, error) {
+	keys := make([]byte, attachmentKeysSize+aes.BlockSize)
+	if _, err := rand.Read(keys); err != nil {
+		return nil, err
+	}
+
+	return newAttachmentEncryptReader(src, keys[:attachmentKeysSize], keys[attachmentKeysSize:])
+}
+
+func newAttachmentEncryptReader(src io.Reader, keys, iv []byte) (*AttachmentEncryptReader, error) {
+	block, err := aes.NewCipher(keys[:attachmentAESKeySize])
+	if err != nil {
+		return nil, err
+	}
+
+	r := &AttachmentEncryptReader{
+		src:   src,
+		keys:  keys,
+		iv:    iv,
+		mode:  cipher.NewCBCEncrypter(block, iv),
+		mac:   hmac.New(sha256.New, keys[attachmentAESKeySize:]),
+		sum:   sha256.New(),
+		chunk: make([]byte, 32*1024),
+	}
+
+	r.write(iv)
+	return r, nil
+}
+
+// Keys returns the aes key followed by the hmac key
+func (r *AttachmentEncryptReader) Keys() []byte {
+	return r.keys
+}
+
+// Digest returns the sha256 of the encrypted data, it is available after reading to EOF
+func (r *AttachmentEncryptReader) Digest() []byte {
+	return r.digest
+}
+
+func (r *AttachmentEncryptReader) write(b []byte) {
+	r.mac.Write(b)
+	r.sum.Write(b)
+	r.out.Write(b)
+}
+
+func (r *AttachmentEncryptReader) Read(p []byte) (int, error) {
+	for r.out.Len() == 0 {
+		if r.digest != nil {
+			return 0, io.EOF
+		}
+
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+	}
+
+	return r.out.Read(p)
+}
+
+func (r *AttachmentEncryptReader) fill() error {
+	n, err := r.src.Read(r.chunk)
+	r.pending = append(r.pending, r.chunk[:n]...)
+
+	eof := errors.Is(err, io.EOF)
+	if err != nil && !eof {
+		return err
+	}
+
+	if eof {
+		padding := aes.BlockSize - len(r.pending)%aes.BlockSize
+		r.pending = append(r.pending, bytes.Repeat([]byte{byte(padding)}, padding)...)
+	}
+
+	if size := len(r.pending) / aes.BlockSize * aes.BlockSize; size > 0 {
+		ciphertext := make([]byte, size)
+		r.mode.CryptBlocks(ciphertext, r.pending[:size])
+		r.pending = append(r.pending[:0], r.pending[size:]...)
+		r.write(ciphertext)
+	}
+
+	if eof {
+		sig := r.mac.Sum(nil)
+		r.sum.Write(sig)
+		r.out.Write(sig)
+		r.digest = r.sum.Sum(nil)
+	}
+
+	return nil
+}
+
+// DecryptAttachment verifies the digest and the mac of the encrypted data then decrypts it,
+// the digest is required
+func DecryptAttachment(data, keys, digest []byte) ([]byte, error) {
+	if len(keys) != attachmentKeysSize {
+		return nil, fmt.Errorf("%w: size %d", ErrInvalidAttachmentKeys, len(keys))
+	}
+
+	size := len(data) - aes.BlockSize - attachmentMACSize
+	if size < aes.BlockSize || size%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("%w: size %d", ErrInvalidAttachmentData, len(data))
+	}
+
+	if len(digest) == 0 {
+		return nil, fmt.Errorf("%w: empty digest", ErrAttachmentDigestMismatch)
+	}
+
+	if sum := sha256.Sum256(data); !hmac.Equal(sum[:], digest) {
+		return nil, ErrAttachmentDigestMismatch
+	}
+
+	body, sig := data[:len(data)-attachmentMACSize], data[len(data)-attachmentMACSize:]
+	mac := hmac.New(sha256.New, keys[attachmentAESKeySize:])
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), sig) {
+		return nil, ErrAttachmentMACMismatch
+	}
+
+	block, err := aes.NewCipher(keys[:attachmentAESKeySize])
+	if err != nil {
+		return nil, err
+	}
+
+	iv := body[:aes.BlockSize]
+	plaintext := make([]byte, size)
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, body[aes.BlockSize:])
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(plaintext[size-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, fmt.Errorf("%w: bad padding", ErrInvalidAttachmentData)
+	}
+
+	return plaintext[:size-padding], nil
+}
@@ -0,0 +1,56 @@
+package mixin
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptAttachment(t *testing.T) {
+	for _, size := range []int{0, 1, 15, 16, 17, 1024} {
+		data := make([]byte, size)
+		_, _ = rand.Read(data)
+
+		encrypted, keys, digest, err := EncryptAttachment(data)
+		require.NoError(t, err)
+
+		decrypted, err := DecryptAttachment(encrypted, keys, digest)
+		require.NoError(t, err, "size %d", size)
+		assert.Equal(t, data, decrypted)
+	}
+
+	data := []byte("attachment")
+	encrypted, keys, digest, err := EncryptAttachment(data)
+	require.NoError(t, err)
+
+	t.Run("tampered data", func(t *testing.T) {
+		tampered := append([]byte{}, encrypted...)
+		tampered[20] ^= 1
+
+		_, err := DecryptAttachment(tampered, keys, digest)
+		assert.True(t, errors.Is(err, ErrAttachmentDigestMismatch))
+
+		sum := sha256.Sum256(tampered)
+		_, err = DecryptAttachment(tampered, keys, sum[:])
+		assert.True(t, errors.Is(err, ErrAttachmentMACMismatch))
+	})
+
+	t.Run("empty digest", func(t *testing.T) {
+		_, err := DecryptAttachment(encrypted, keys, nil)
+		assert.True(t, errors.Is(err, ErrAttachmentDigestMismatch))
+	})
+
+	t.Run("wrong keys", func(t *testing.T) {
+		_, err := DecryptAttachment(encrypted, keys[:32], digest)
+		assert.True(t, errors.Is(err, ErrInvalidAttachmentKeys))
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := DecryptAttachment(encrypted[:40], keys, digest)
+		assert.True(t, errors.Is(err, ErrInvalidAttachmentData))
+	})
+}
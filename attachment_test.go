@@ -1,9 +1,17 @@
 package mixin
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -24,3 +32,268 @@ func TestUploadAttachment(t *testing.T) {
 	err = UploadAttachment(ctx, attachment, data)
 	assert.Nil(t, err, "upload attachment")
 }
+
+func TestUploadAttachmentReader(t *testing.T) {
+	var (
+		calls    int
+		uploaded []byte
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		if r.ContentLength != int64(len(body)) {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		uploaded = body
+	}))
+	defer srv.Close()
+
+	data := bytes.Repeat([]byte("attachment"), 1024)
+
+	var last int64
+	err := UploadAttachmentReaderTo(
+		context.Background(),
+		srv.URL,
+		bytes.NewReader(data),
+		int64(len(data)),
+		WithUploadRetry(1, time.Millisecond),
+		WithUploadProgress(func(n, total int64) {
+			assert.Equal(t, int64(len(data)), total)
+			last = n
+		}),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, data, uploaded)
+	assert.Equal(t, int64(len(data)), last)
+
+	t.Run("not seekable", func(t *testing.T) {
+		calls = 0
+		err := UploadAttachmentReaderTo(context.Background(), srv.URL, io.LimitReader(bytes.NewReader(data), 10), 10, WithUploadRetry(3, time.Millisecond))
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls, "not retried")
+	})
+
+	t.Run("unknown size", func(t *testing.T) {
+		calls = 0
+		err := UploadAttachmentReaderTo(context.Background(), srv.URL, io.LimitReader(bytes.NewReader(data), 10), -1, WithUploadRetry(3, time.Millisecond))
+		require.NoError(t, err)
+		assert.Equal(t, 2, calls, "buffered and retried")
+		assert.Equal(t, data[:10], uploaded)
+
+		assert.Error(t, uploadAttachment(context.Background(), srv.URL, bytes.NewReader(data), -1, nil), "chunked upload")
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		calls = 1
+		er, err := NewAttachmentEncryptReader(bytes.NewReader(data))
+		require.NoError(t, err)
+
+		require.NoError(t, UploadAttachmentReaderTo(context.Background(), srv.URL, er, EncryptedAttachmentSize(int64(len(data)))))
+		decrypted, err := DecryptAttachment(uploaded, er.Keys(), er.Digest())
+		require.NoError(t, err)
+		assert.Equal(t, data, decrypted)
+	})
+}
+
+// newTestAPIServer serves the api with handler until the test ends, responses
+// written by writeTestAPIData are wrapped as the api does
+func newTestAPIServer(t *testing.T, handler http.Handler) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(xRequestID, r.Header.Get(xRequestID))
+		handler.ServeHTTP(w, r)
+	}))
+
+	base := GetRestyClient().BaseURL
+	GetRestyClient().SetBaseURL(srv.URL)
+	t.Cleanup(func() {
+		GetRestyClient().SetBaseURL(base)
+		srv.Close()
+	})
+
+	return srv
+}
+
+func writeTestAPIData(w http.ResponseWriter, data interface{}) {
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func TestDownloadAttachment(t *testing.T) {
+	data := bytes.Repeat([]byte("attachment"), 1024)
+	attachmentID := newUUID()
+
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/attachments/"+attachmentID, func(w http.ResponseWriter, r *http.Request) {
+		writeTestAPIData(w, Attachment{AttachmentID: attachmentID, ViewURL: srv.URL + "/view/" + attachmentID})
+	})
+	mux.HandleFunc("/view/"+attachmentID, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(data)
+	})
+	srv = newTestAPIServer(t, mux)
+
+	ctx := context.Background()
+	r, err := NewFromAccessToken("token").DownloadAttachment(ctx, attachmentID)
+	require.NoError(t, err)
+	defer r.Close()
+
+	downloaded, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, data, downloaded)
+
+	_, err = DownloadAttachmentFrom(ctx, srv.URL+"/view/missing")
+	assert.Error(t, err)
+}
+
+func TestSendAttachment(t *testing.T) {
+	var (
+		srv       *httptest.Server
+		uploaded  []byte
+		created   int
+		sessions  []*Session
+		plain     []*MessageRequest
+		encrypted []*MessageRequest
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/attachments", func(w http.ResponseWriter, r *http.Request) {
+		created++
+		id := newUUID()
+		writeTestAPIData(w, Attachment{AttachmentID: id, UploadURL: srv.URL + "/upload/" + id})
+	})
+	mux.HandleFunc("/upload/", func(w http.ResponseWriter, r *http.Request) {
+		uploaded, _ = io.ReadAll(r.Body)
+	})
+	mux.HandleFunc("/sessions/fetch", func(w http.ResponseWriter, r *http.Request) {
+		writeTestAPIData(w, sessions)
+	})
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		var msg MessageRequest
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		plain = append(plain, &msg)
+		writeTestAPIData(w, nil)
+	})
+	mux.HandleFunc("/encrypted_messages", func(w http.ResponseWriter, r *http.Request) {
+		var messages []*MessageRequest
+		_ = json.NewDecoder(r.Body).Decode(&messages)
+		encrypted = append(encrypted, messages...)
+
+		var receipts []*EncryptedMessageReceipt
+		for _, msg := range messages {
+			receipts = append(receipts, &EncryptedMessageReceipt{
+				MessageID:   msg.MessageID,
+				RecipientID: msg.RecipientID,
+				State:       EncryptedMessageReceiptStateSuccess,
+			})
+		}
+		writeTestAPIData(w, receipts)
+	})
+	srv = newTestAPIServer(t, mux)
+
+	ctx := context.Background()
+	c := NewFromAccessToken("token")
+	c.ClientID = newUUID()
+	c.MessageLocker = testMessageLocker{}
+
+	data := bytes.Repeat([]byte("attachment"), 1024)
+	recipientID := newUUID()
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := c.SendImage(ctx, &SendAttachmentInput{
+			RecipientID: recipientID,
+			Reader:      bytes.NewReader(data),
+			Size:        int64(len(data)),
+			MimeType:    "image/png",
+		})
+		assert.ErrorIs(t, err, ErrInvalidMessage)
+
+		_, err = c.SendFile(ctx, &SendAttachmentInput{
+			RecipientID: recipientID,
+			Reader:      bytes.NewReader(data),
+			Size:        int64(len(data)),
+			MimeType:    "text/plain",
+		})
+		assert.ErrorIs(t, err, ErrInvalidMessage)
+		assert.Zero(t, created, "validated before uploading")
+	})
+
+	t.Run("plain", func(t *testing.T) {
+		msg, err := c.SendFile(ctx, &SendAttachmentInput{
+			RecipientID: recipientID,
+			Reader:      strings.NewReader(string(data)),
+			Size:        -1,
+			MimeType:    "text/plain",
+			Name:        "data.txt",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, data, uploaded)
+
+		require.Len(t, plain, 1)
+		assert.Equal(t, msg.MessageID, plain[0].MessageID)
+		assert.Equal(t, MessageCategoryPlainData, plain[0].Category)
+		assert.Equal(t, UniqueConversationID(c.ClientID, recipientID), plain[0].ConversationID)
+
+		raw, err := dumpRawData(plain[0])
+		require.NoError(t, err)
+
+		var file DataMessage
+		require.NoError(t, json.Unmarshal(raw, &file))
+		assert.Equal(t, len(data), file.Size)
+		assert.Equal(t, "data.txt", file.Name)
+		assert.Nil(t, file.AttachmentMessageEncrypt)
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		plain, created = nil, 0
+		sessions = []*Session{{UserID: recipientID, SessionID: newUUID()}}
+
+		_, err := c.SendVideo(ctx, &SendAttachmentInput{
+			RecipientID: recipientID,
+			Reader:      bytes.NewReader(data),
+			Size:        int64(len(data)),
+			MimeType:    "video/mp4",
+			Encrypt:     true,
+		})
+		assert.Error(t, err, "sessions without public key")
+		assert.Zero(t, created)
+
+		sessions[0].PublicKey = "public key"
+		msg, err := c.SendImage(ctx, &SendAttachmentInput{
+			RecipientID: recipientID,
+			Reader:      bytes.NewReader(data),
+			Size:        int64(len(data)),
+			MimeType:    "image/png",
+			Width:       10,
+			Height:      10,
+			Encrypt:     true,
+		})
+		require.NoError(t, err)
+		assert.Empty(t, plain, "the key is never sent plain")
+
+		require.Len(t, encrypted, 1)
+		assert.Equal(t, msg.MessageID, encrypted[0].MessageID)
+		assert.Equal(t, EncryptMessageCategory(MessageCategoryPlainImage), encrypted[0].Category)
+
+		locked, err := base64.RawURLEncoding.DecodeString(encrypted[0].DataBase64)
+		require.NoError(t, err)
+		raw, err := c.Unlock(locked)
+		require.NoError(t, err)
+
+		var image ImageMessage
+		require.NoError(t, json.Unmarshal(raw, &image))
+		require.NotNil(t, image.AttachmentMessageEncrypt)
+		assert.Equal(t, len(data), image.Size)
+
+		decrypted, err := DecryptAttachment(uploaded, image.Key, image.Digest)
+		require.NoError(t, err)
+		assert.Equal(t, data, decrypted)
+	})
+}
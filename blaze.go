@@ -50,10 +50,13 @@ type MessageView struct {
 
 	// ack status
 	ack bool
+	// redeliver leaves the message unhandled and unacked, set by BlazeRecoverRedeliver
+	redeliver bool
 }
 
 func (m *MessageView) reset() {
 	m.ack = false
+	m.redeliver = false
 	m.RepresentativeID = ""
 	m.QuoteMessageID = ""
 }
@@ -90,17 +93,32 @@ type BlazeListener interface {
 type BlazeOption func(dialer *websocket.Dialer)
 
 func (c *Client) LoopBlaze(ctx context.Context, listener BlazeListener, opts ...BlazeOption) error {
-	conn, err := connectMixinBlaze(c, opts...)
-	if err != nil {
+	return c.LoopBlazeWithStore(ctx, listener, nil, opts...)
+}
+
+// LoopBlazeWithStore is same as LoopBlaze but skips messages already handled
+// according to the store, and persists pending acknowledgements in it
+func (c *Client) LoopBlazeWithStore(ctx context.Context, listener BlazeListener, store BlazeStore, opts ...BlazeOption) error {
+	b := &blazeHandler{
+		Client: c,
+		store:  store,
+	}
+
+	if err := b.loadPendingAcks(ctx); err != nil {
 		return err
 	}
 
-	defer conn.Close()
+	return b.loop(ctx, listener, opts...)
+}
 
-	b := &blazeHandler{
-		Client: c,
+func (b *blazeHandler) loop(ctx context.Context, listener BlazeListener, opts ...BlazeOption) error {
+	conn, err := b.connect(ctx, opts...)
+	if err != nil {
+		return err
 	}
 
+	defer conn.Close()
+
 	_ = conn.SetReadDeadline(time.Now().Add(pongWait))
 	conn.SetPongHandler(func(s string) error {
 		return conn.SetReadDeadline(time.Now().Add(pongWait))
@@ -110,6 +128,10 @@ func (c *Client) LoopBlaze(ctx context.Context, listener BlazeListener, opts ...
 		return fmt.Errorf("write LIST_PENDING_MESSAGES failed: %w", err)
 	}
 
+	if b.onConnected != nil {
+		b.onConnected()
+	}
+
 	g, ctx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
@@ -160,7 +182,7 @@ func (c *Client) LoopBlaze(ctx context.Context, listener BlazeListener, opts ...
 					return err
 				}
 
-				rawData, err := c.Unlock(data)
+				rawData, err := b.Unlock(data)
 				if err != nil {
 					return err
 				}
@@ -172,17 +194,9 @@ func (c *Client) LoopBlaze(ctx context.Context, listener BlazeListener, opts ...
 
 			switch blazeMessage.Action {
 			case CreateMessageAction:
-				messageID := message.MessageID
-				if err := listener.OnMessage(ctx, &message, b.ClientID); err != nil {
+				if err := b.handleMessage(ctx, listener, &message); err != nil {
 					return err
 				}
-
-				if !message.ack {
-					b.queue.pushBack(&AcknowledgementRequest{
-						MessageID: messageID,
-						Status:    MessageStatusRead,
-					})
-				}
 			case AcknowledgeReceiptAction:
 				if err := listener.OnAckReceipt(ctx, &message, b.ClientID); err != nil {
 					return err
@@ -194,6 +208,40 @@ func (c *Client) LoopBlaze(ctx context.Context, listener BlazeListener, opts ...
 	return g.Wait()
 }
 
+// handleMessage passes the message to the listener unless it is handled already,
+// messages left for redelivery are neither marked as handled nor acked
+func (b *blazeHandler) handleMessage(ctx context.Context, listener BlazeListener, message *MessageView) error {
+	messageID := message.MessageID
+	handled, err := b.isHandled(ctx, messageID)
+	if err != nil {
+		return err
+	}
+
+	if !handled {
+		if err := listener.OnMessage(ctx, message, b.ClientID); err != nil {
+			return err
+		}
+
+		if message.redeliver {
+			return nil
+		}
+
+		if err := b.markHandled(ctx, messageID); err != nil {
+			return err
+		}
+	}
+
+	// ack again if the message is redelivered
+	if handled || !message.ack {
+		return b.pushAck(ctx, &AcknowledgementRequest{
+			MessageID: messageID,
+			Status:    MessageStatusRead,
+		})
+	}
+
+	return nil
+}
+
 func connectMixinBlaze(s Signer, opts ...BlazeOption) (*websocket.Conn, error) {
 	sig := SignRaw("GET", "/", nil)
 	token := s.SignToken(sig, newRequestID(), time.Minute)
@@ -3,9 +3,12 @@ package mixin
 import (
 	"container/list"
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
+	"github.com/gorilla/websocket"
+
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/sync/semaphore"
 )
@@ -52,6 +55,65 @@ func (q *AckQueue) pull(limit int) []*AcknowledgementRequest {
 type blazeHandler struct {
 	*Client
 	queue AckQueue
+	store BlazeStore
+
+	// dialSem limits concurrent dials, optional
+	dialSem *semaphore.Weighted
+	// onConnected is called once the connection is ready, optional
+	onConnected func()
+}
+
+func (b *blazeHandler) connect(ctx context.Context, opts ...BlazeOption) (*websocket.Conn, error) {
+	if b.dialSem != nil {
+		if err := b.dialSem.Acquire(ctx, 1); err != nil {
+			return nil, err
+		}
+
+		defer b.dialSem.Release(1)
+	}
+
+	return connectMixinBlaze(b.Client, opts...)
+}
+
+func (b *blazeHandler) loadPendingAcks(ctx context.Context) error {
+	if b.store == nil {
+		return nil
+	}
+
+	requests, err := b.store.ListPendingAcks(ctx)
+	if err != nil {
+		return fmt.Errorf("list pending acks failed: %w", err)
+	}
+
+	b.queue.pushBack(requests...)
+	return nil
+}
+
+func (b *blazeHandler) isHandled(ctx context.Context, messageID string) (bool, error) {
+	if b.store == nil {
+		return false, nil
+	}
+
+	return b.store.IsHandled(ctx, messageID)
+}
+
+func (b *blazeHandler) markHandled(ctx context.Context, messageID string) error {
+	if b.store == nil {
+		return nil
+	}
+
+	return b.store.MarkHandled(ctx, messageID)
+}
+
+func (b *blazeHandler) pushAck(ctx context.Context, request *AcknowledgementRequest) error {
+	if b.store != nil {
+		if err := b.store.AddPendingAcks(ctx, []*AcknowledgementRequest{request}); err != nil {
+			return err
+		}
+	}
+
+	b.queue.pushBack(request)
+	return nil
 }
 
 func (b *blazeHandler) ack(ctx context.Context) error {
@@ -85,9 +147,14 @@ func (b *blazeHandler) ack(ctx context.Context) error {
 					err := b.SendAcknowledgements(ctx, requests)
 					if err != nil {
 						b.queue.pushFront(requests...)
+						return err
+					}
+
+					if b.store != nil {
+						return b.store.RemovePendingAcks(ctx, requests)
 					}
 
-					return err
+					return nil
 				})
 			}
 		}
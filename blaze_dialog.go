@@ -0,0 +1,476 @@
+package mixin
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultDialogTimeout = 10 * time.Minute
+
+type (
+	// DialogState is the persisted state of a dialog between a user and the bot in a conversation
+	DialogState struct {
+		ConversationID string            `json:"conversation_id"`
+		UserID         string            `json:"user_id"`
+		Flow           string            `json:"flow"`
+		Step           string            `json:"step"`
+		Data           map[string]string `json:"data,omitempty"`
+		ExpiredAt      time.Time         `json:"expired_at"`
+		UpdatedAt      time.Time         `json:"updated_at"`
+	}
+
+	// DialogStore persists dialog states
+	DialogStore interface {
+		// ReadDialog returns nil if the dialog not found
+		ReadDialog(ctx context.Context, conversationID, userID string) (*DialogState, error)
+		SaveDialog(ctx context.Context, state *DialogState) error
+		DeleteDialog(ctx context.Context, conversationID, userID string) error
+	}
+
+	// DialogSweepStore is a DialogStore able to list the expired dialogs, required by
+	// DialogManager.Sweep. The memory and file stores implement it.
+	DialogSweepStore interface {
+		DialogStore
+		// ListExpiredDialogs returns the dialogs expired before t
+		ListExpiredDialogs(ctx context.Context, t time.Time) ([]*DialogState, error)
+	}
+
+	// DialogStep handles a message routed to the active step of the dialog,
+	// call Dialog.Next to move on or Dialog.End to finish, otherwise the dialog
+	// stays in the current step
+	DialogStep func(ctx context.Context, d *Dialog, msg *MessageView) error
+
+	// DialogFlow is a set of steps making up a multi-step interaction
+	DialogFlow struct {
+		Name string
+		// Start is the name of the first step
+		Start string
+		Steps map[string]DialogStep
+		// Trigger starts the flow with the message if there is no active dialog, optional
+		Trigger func(msg *MessageView) bool
+		// Timeout expires the dialog if the user doesn't reply in time, default is 10 minutes
+		Timeout time.Duration
+		// OnTimeout is called when the dialog is found expired, optional. Without
+		// DialogManager.Sweep or RunSweep, an expired dialog is only found when the
+		// next message of the user arrives, so OnTimeout may be called late or never
+		OnTimeout func(ctx context.Context, state *DialogState) error
+		// OnCancel is called after the dialog is cancelled, optional
+		OnCancel func(ctx context.Context, state *DialogState) error
+	}
+)
+
+// Dialog is passed to a DialogStep to read and update the dialog state
+type Dialog struct {
+	*DialogState
+	next  string
+	ended bool
+}
+
+// Next moves the dialog to the step after the current message
+func (d *Dialog) Next(step string) {
+	d.next = step
+}
+
+// End finishes the dialog after the current message
+func (d *Dialog) End() {
+	d.ended = true
+}
+
+func (d *Dialog) Get(key string) string {
+	return d.Data[key]
+}
+
+func (d *Dialog) Set(key, value string) {
+	if d.Data == nil {
+		d.Data = make(map[string]string)
+	}
+
+	d.Data[key] = value
+}
+
+// DialogManager is a BlazeListener routing messages, payments included, to the
+// active step of the dialog of (conversation, user), messages without
+// an active dialog are passed to the fallback listener
+type DialogManager struct {
+	store    DialogStore
+	fallback BlazeListener
+	flows    map[string]*DialogFlow
+	order    []string
+
+	// CancelKeywords cancel the active dialog when received as plain text, case insensitive
+	CancelKeywords []string
+}
+
+func NewDialogManager(store DialogStore, fallback BlazeListener) *DialogManager {
+	return &DialogManager{
+		store:          store,
+		fallback:       fallback,
+		flows:          make(map[string]*DialogFlow),
+		CancelKeywords: []string{"cancel"},
+	}
+}
+
+// Register adds the flow, flows with Trigger are checked in the registered order
+func (m *DialogManager) Register(flow *DialogFlow) {
+	if flow.Timeout <= 0 {
+		flow.Timeout = defaultDialogTimeout
+	}
+
+	if _, ok := m.flows[flow.Name]; !ok {
+		m.order = append(m.order, flow.Name)
+	}
+
+	m.flows[flow.Name] = flow
+}
+
+// Start starts the flow at its first step, replacing the active dialog if any
+func (m *DialogManager) Start(ctx context.Context, conversationID, userID, flowName string, data map[string]string) (*DialogState, error) {
+	flow, ok := m.flows[flowName]
+	if !ok {
+		return nil, fmt.Errorf("dialog flow %s not found", flowName)
+	}
+
+	now := time.Now()
+	state := &DialogState{
+		ConversationID: conversationID,
+		UserID:         userID,
+		Flow:           flow.Name,
+		Step:           flow.Start,
+		Data:           data,
+		ExpiredAt:      now.Add(flow.Timeout),
+		UpdatedAt:      now,
+	}
+
+	if err := m.store.SaveDialog(ctx, state); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// Cancel ends the active dialog and calls OnCancel of its flow
+func (m *DialogManager) Cancel(ctx context.Context, conversationID, userID string) error {
+	state, err := m.store.ReadDialog(ctx, conversationID, userID)
+	if err != nil || state == nil {
+		return err
+	}
+
+	if err := m.store.DeleteDialog(ctx, conversationID, userID); err != nil {
+		return err
+	}
+
+	if flow, ok := m.flows[state.Flow]; ok && flow.OnCancel != nil {
+		return flow.OnCancel(ctx, state)
+	}
+
+	return nil
+}
+
+func (m *DialogManager) OnAckReceipt(ctx context.Context, msg *MessageView, userID string) error {
+	if m.fallback != nil {
+		return m.fallback.OnAckReceipt(ctx, msg, userID)
+	}
+
+	return nil
+}
+
+func (m *DialogManager) OnMessage(ctx context.Context, msg *MessageView, userID string) error {
+	state, err := m.store.ReadDialog(ctx, msg.ConversationID, msg.UserID)
+	if err != nil {
+		return err
+	}
+
+	if state != nil && time.Now().After(state.ExpiredAt) {
+		if err := m.expire(ctx, state); err != nil {
+			return err
+		}
+
+		state = nil
+	}
+
+	if state == nil {
+		for _, name := range m.order {
+			if flow := m.flows[name]; flow.Trigger != nil && flow.Trigger(msg) {
+				if state, err = m.Start(ctx, msg.ConversationID, msg.UserID, name, nil); err != nil {
+					return err
+				}
+
+				break
+			}
+		}
+	} else if m.isCancel(msg) {
+		return m.Cancel(ctx, msg.ConversationID, msg.UserID)
+	}
+
+	if state == nil {
+		if m.fallback != nil {
+			return m.fallback.OnMessage(ctx, msg, userID)
+		}
+
+		return nil
+	}
+
+	flow, ok := m.flows[state.Flow]
+	if !ok {
+		return m.store.DeleteDialog(ctx, state.ConversationID, state.UserID)
+	}
+
+	step, ok := flow.Steps[state.Step]
+	if !ok {
+		return fmt.Errorf("dialog step %s of flow %s not found", state.Step, state.Flow)
+	}
+
+	d := &Dialog{DialogState: state}
+	if err := step(ctx, d, msg); err != nil {
+		return err
+	}
+
+	if d.ended {
+		return m.store.DeleteDialog(ctx, state.ConversationID, state.UserID)
+	}
+
+	if d.next != "" {
+		state.Step = d.next
+	}
+
+	state.UpdatedAt = time.Now()
+	state.ExpiredAt = state.UpdatedAt.Add(flow.Timeout)
+	return m.store.SaveDialog(ctx, state)
+}
+
+// expire deletes the expired dialog and calls OnTimeout of its flow
+func (m *DialogManager) expire(ctx context.Context, state *DialogState) error {
+	if err := m.store.DeleteDialog(ctx, state.ConversationID, state.UserID); err != nil {
+		return err
+	}
+
+	if flow, ok := m.flows[state.Flow]; ok && flow.OnTimeout != nil {
+		return flow.OnTimeout(ctx, state)
+	}
+
+	return nil
+}
+
+// Sweep expires the dialogs timed out so far and calls OnTimeout of their flows,
+// the store must implement DialogSweepStore
+func (m *DialogManager) Sweep(ctx context.Context) error {
+	store, ok := m.store.(DialogSweepStore)
+	if !ok {
+		return errors.New("dialog store doesn't support sweeping")
+	}
+
+	now := time.Now()
+	expired, err := store.ListExpiredDialogs(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for _, listed := range expired {
+		// the dialog may be renewed by a message after listed
+		state, err := store.ReadDialog(ctx, listed.ConversationID, listed.UserID)
+		if err != nil {
+			return err
+		}
+
+		if state == nil || !now.After(state.ExpiredAt) {
+			continue
+		}
+
+		if err := m.expire(ctx, state); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RunSweep sweeps every interval until ctx is done, sweep errors are retried in the next round
+func (m *DialogManager) RunSweep(ctx context.Context, interval time.Duration, onError func(err error)) error {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	for {
+		if err := m.Sweep(ctx); err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+
+		if err := sleepContext(ctx, interval); err != nil {
+			return err
+		}
+	}
+}
+
+func (m *DialogManager) isCancel(msg *MessageView) bool {
+	if msg.Category != MessageCategoryPlainText || len(m.CancelKeywords) == 0 {
+		return false
+	}
+
+	data, err := base64.StdEncoding.DecodeString(msg.Data)
+	if err != nil {
+		return false
+	}
+
+	text := strings.TrimSpace(string(data))
+	for _, keyword := range m.CancelKeywords {
+		if strings.EqualFold(text, keyword) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func dialogKey(conversationID, userID string) string {
+	return conversationID + ":" + userID
+}
+
+type memoryDialogStore struct {
+	dialogs map[string]DialogState
+	mux     sync.Mutex
+}
+
+// NewMemoryDialogStore returns a DialogStore living in memory
+func NewMemoryDialogStore() DialogStore {
+	return &memoryDialogStore{
+		dialogs: make(map[string]DialogState),
+	}
+}
+
+func (s *memoryDialogStore) ReadDialog(_ context.Context, conversationID, userID string) (*DialogState, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	state, ok := s.dialogs[dialogKey(conversationID, userID)]
+	if !ok {
+		return nil, nil
+	}
+
+	state.Data = maps.Clone(state.Data)
+	return &state, nil
+}
+
+func (s *memoryDialogStore) SaveDialog(_ context.Context, state *DialogState) error {
+	saved := *state
+	saved.Data = maps.Clone(state.Data)
+
+	s.mux.Lock()
+	s.dialogs[dialogKey(state.ConversationID, state.UserID)] = saved
+	s.mux.Unlock()
+	return nil
+}
+
+func (s *memoryDialogStore) ListExpiredDialogs(_ context.Context, t time.Time) ([]*DialogState, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var states []*DialogState
+	for _, state := range s.dialogs {
+		if t.After(state.ExpiredAt) {
+			state.Data = maps.Clone(state.Data)
+			states = append(states, &state)
+		}
+	}
+
+	return states, nil
+}
+
+func (s *memoryDialogStore) DeleteDialog(_ context.Context, conversationID, userID string) error {
+	s.mux.Lock()
+	delete(s.dialogs, dialogKey(conversationID, userID))
+	s.mux.Unlock()
+	return nil
+}
+
+type fileDialogStore struct {
+	dir string
+}
+
+// NewFileDialogStore returns a DialogStore saving every dialog as a json file in dir
+func NewFileDialogStore(dir string) (DialogStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &fileDialogStore{dir: dir}, nil
+}
+
+func (s *fileDialogStore) path(conversationID, userID string) string {
+	return filepath.Join(s.dir, uuidHash([]byte(dialogKey(conversationID, userID)))+".json")
+}
+
+func (s *fileDialogStore) ReadDialog(_ context.Context, conversationID, userID string) (*DialogState, error) {
+	return readDialogFile(s.path(conversationID, userID))
+}
+
+// readDialogFile returns nil if the file not found
+func readDialogFile(path string) (*DialogState, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var state DialogState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+func (s *fileDialogStore) ListExpiredDialogs(_ context.Context, t time.Time) ([]*DialogState, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var states []*DialogState
+	for _, path := range paths {
+		state, err := readDialogFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if state != nil && t.After(state.ExpiredAt) {
+			states = append(states, state)
+		}
+	}
+
+	return states, nil
+}
+
+func (s *fileDialogStore) SaveDialog(_ context.Context, state *DialogState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	path := s.path(state.ConversationID, state.UserID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func (s *fileDialogStore) DeleteDialog(_ context.Context, conversationID, userID string) error {
+	if err := os.Remove(s.path(conversationID, userID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,162 @@
+package mixin
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTextMessage(conversationID, userID, text string) *MessageView {
+	return &MessageView{
+		ConversationID: conversationID,
+		UserID:         userID,
+		MessageID:      newUUID(),
+		Category:       MessageCategoryPlainText,
+		Data:           base64.StdEncoding.EncodeToString([]byte(text)),
+	}
+}
+
+func testDialogManager(t *testing.T, store DialogStore) {
+	ctx := context.Background()
+	conversationID, userID := newUUID(), newUUID()
+
+	var (
+		fallbacks int
+		receipt   string
+	)
+
+	m := NewDialogManager(store, BlazeListenFunc(func(ctx context.Context, msg *MessageView, userID string) error {
+		fallbacks++
+		return nil
+	}))
+
+	m.Register(&DialogFlow{
+		Name:  "pay",
+		Start: "ask",
+		Trigger: func(msg *MessageView) bool {
+			return msg.Category == MessageCategoryPlainText && msg.Data == base64.StdEncoding.EncodeToString([]byte("/pay"))
+		},
+		Steps: map[string]DialogStep{
+			"ask": func(ctx context.Context, d *Dialog, msg *MessageView) error {
+				d.Next("amount")
+				return nil
+			},
+			"amount": func(ctx context.Context, d *Dialog, msg *MessageView) error {
+				amount, _ := base64.StdEncoding.DecodeString(msg.Data)
+				d.Set("amount", string(amount))
+				d.Next("paid")
+				return nil
+			},
+			"paid": func(ctx context.Context, d *Dialog, msg *MessageView) error {
+				if msg.Category != MessageCategorySystemSafeSnapshot {
+					return nil
+				}
+
+				receipt = d.Get("amount")
+				d.End()
+				return nil
+			},
+		},
+	})
+
+	require.NoError(t, m.OnMessage(ctx, newTestTextMessage(conversationID, userID, "hi"), ""))
+	assert.Equal(t, 1, fallbacks)
+
+	require.NoError(t, m.OnMessage(ctx, newTestTextMessage(conversationID, userID, "/pay"), ""))
+	require.NoError(t, m.OnMessage(ctx, newTestTextMessage(conversationID, userID, "10"), ""))
+
+	state, err := store.ReadDialog(ctx, conversationID, userID)
+	require.NoError(t, err)
+	require.NotNil(t, state)
+	assert.Equal(t, "paid", state.Step)
+
+	// stay in the step
+	require.NoError(t, m.OnMessage(ctx, newTestTextMessage(conversationID, userID, "what?"), ""))
+	require.NoError(t, m.OnMessage(ctx, &MessageView{
+		ConversationID: conversationID,
+		UserID:         userID,
+		Category:       MessageCategorySystemSafeSnapshot,
+	}, ""))
+	assert.Equal(t, "10", receipt)
+	assert.Equal(t, 1, fallbacks)
+
+	state, err = store.ReadDialog(ctx, conversationID, userID)
+	require.NoError(t, err)
+	assert.Nil(t, state)
+
+	t.Run("cancel", func(t *testing.T) {
+		require.NoError(t, m.OnMessage(ctx, newTestTextMessage(conversationID, userID, "/pay"), ""))
+		require.NoError(t, m.OnMessage(ctx, newTestTextMessage(conversationID, userID, "Cancel"), ""))
+
+		state, err := store.ReadDialog(ctx, conversationID, userID)
+		require.NoError(t, err)
+		assert.Nil(t, state)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		var timeouts int
+		m.Register(&DialogFlow{
+			Name:    "quick",
+			Timeout: time.Millisecond,
+			OnTimeout: func(ctx context.Context, state *DialogState) error {
+				timeouts++
+				return nil
+			},
+		})
+
+		_, err := m.Start(ctx, conversationID, userID, "quick", nil)
+		require.NoError(t, err)
+		time.Sleep(2 * time.Millisecond)
+
+		require.NoError(t, m.OnMessage(ctx, newTestTextMessage(conversationID, userID, "late"), ""))
+		assert.Equal(t, 1, timeouts)
+		assert.Equal(t, 2, fallbacks)
+
+		// expired by the sweep without waiting for a message
+		_, err = m.Start(ctx, conversationID, userID, "quick", nil)
+		require.NoError(t, err)
+		_, err = m.Start(ctx, newUUID(), userID, "pay", nil)
+		require.NoError(t, err)
+		time.Sleep(2 * time.Millisecond)
+
+		require.NoError(t, m.Sweep(ctx))
+		assert.Equal(t, 2, timeouts)
+
+		state, err := store.ReadDialog(ctx, conversationID, userID)
+		require.NoError(t, err)
+		assert.Nil(t, state)
+
+		require.NoError(t, m.Sweep(ctx))
+		assert.Equal(t, 2, timeouts, "the pay dialog is not expired")
+	})
+
+	t.Run("data copied", func(t *testing.T) {
+		data := map[string]string{"amount": "1"}
+		state, err := m.Start(ctx, conversationID, userID, "pay", data)
+		require.NoError(t, err)
+
+		data["amount"] = "2"
+		state.Data["amount"] = "3"
+
+		saved, err := store.ReadDialog(ctx, conversationID, userID)
+		require.NoError(t, err)
+		require.NotNil(t, saved)
+		assert.Equal(t, "1", saved.Data["amount"])
+	})
+}
+
+func TestDialogManager(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testDialogManager(t, NewMemoryDialogStore())
+	})
+
+	t.Run("file", func(t *testing.T) {
+		store, err := NewFileDialogStore(t.TempDir())
+		require.NoError(t, err)
+		testDialogManager(t, store)
+	})
+}
@@ -0,0 +1,421 @@
+package mixin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	defaultBlazeHubMaxDials      = 5
+	defaultBlazeHubRetryInterval = time.Second
+	maxBlazeHubRetryInterval     = time.Minute
+	defaultBlazeHubLockTTL       = 15 * time.Second
+)
+
+var ErrBlazeSessionExists = errors.New("blaze session already exists")
+
+type (
+	// BlazeHubConfig configures a BlazeHub
+	BlazeHubConfig struct {
+		// MaxConcurrentDials limits the connections dialing at the same time, default is 5
+		MaxConcurrentDials int
+		// RetryInterval is the initial wait before reconnecting, doubled after each failure
+		// up to one minute, default is one second
+		RetryInterval time.Duration
+		// Store returns the BlazeStore of a client, optional
+		Store func(clientID string) BlazeStore
+		// Options are applied to every connection
+		Options []BlazeOption
+		// Locker elects the replica consuming messages of a client, optional.
+		// A session waits for the lease of its client id before connecting,
+		// keeps renewing it while running and releases it on shutdown.
+		Locker BlazeLocker
+		// LockTTL is the lease ttl, a dead leader is taken over after it expires, default is 15 seconds
+		LockTTL time.Duration
+		// Holder identifies this replica for the Locker, default is hostname with a random uuid
+		Holder string
+	}
+
+	// BlazeSessionStatus is the status of one blaze connection in the hub,
+	// the times are nil until the events happen
+	BlazeSessionStatus struct {
+		ClientID      string     `json:"client_id"`
+		Leader        bool       `json:"leader"`
+		Connected     bool       `json:"connected"`
+		ConnectedAt   *time.Time `json:"connected_at,omitempty"`
+		LastMessageAt *time.Time `json:"last_message_at,omitempty"`
+		LastError     string     `json:"last_error,omitempty"`
+		LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+		Reconnects    int        `json:"reconnects"`
+	}
+
+	// BlazeHubStatus aggregates the status of all sessions in the hub
+	BlazeHubStatus struct {
+		Total        int                   `json:"total"`
+		Connected    int                   `json:"connected"`
+		Disconnected int                   `json:"disconnected"`
+		Sessions     []*BlazeSessionStatus `json:"sessions"`
+	}
+)
+
+// BlazeHub manages blaze connections of many clients and dispatches
+// all their messages to one listener, the userID passed to the listener
+// is the client id owning the connection
+type BlazeHub struct {
+	listener BlazeListener
+	cfg      BlazeHubConfig
+	dialSem  *semaphore.Weighted
+
+	mux      sync.Mutex
+	ctx      context.Context
+	wg       sync.WaitGroup
+	sessions map[string]*blazeSession
+
+	// onLeaderChange observes the sessions gaining and losing the lease, optional
+	onLeaderChange func(clientID string, leader bool)
+}
+
+type blazeSession struct {
+	handler *blazeHandler
+	cancel  context.CancelFunc
+	// onLeaderChange is onLeaderChange of the hub
+	onLeaderChange func(clientID string, leader bool)
+
+	mux    sync.Mutex
+	status BlazeSessionStatus
+}
+
+func NewBlazeHub(listener BlazeListener, cfg BlazeHubConfig) *BlazeHub {
+	if cfg.MaxConcurrentDials <= 0 {
+		cfg.MaxConcurrentDials = defaultBlazeHubMaxDials
+	}
+
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = defaultBlazeHubRetryInterval
+	}
+
+	if cfg.LockTTL <= 0 {
+		cfg.LockTTL = defaultBlazeHubLockTTL
+	}
+
+	if cfg.Holder == "" {
+		hostname, _ := os.Hostname()
+		cfg.Holder = hostname + ":" + newUUID()
+	}
+
+	return &BlazeHub{
+		listener: listener,
+		cfg:      cfg,
+		dialSem:  semaphore.NewWeighted(int64(cfg.MaxConcurrentDials)),
+		sessions: make(map[string]*blazeSession),
+	}
+}
+
+// Add adds the client of the keystore to the hub,
+// it starts looping at once if the hub is running
+func (h *BlazeHub) Add(keystore *Keystore) error {
+	client, err := NewFromKeystore(keystore)
+	if err != nil {
+		return err
+	}
+
+	return h.AddClient(client)
+}
+
+// AddClient adds the client to the hub,
+// it starts looping at once if the hub is running
+func (h *BlazeHub) AddClient(client *Client) error {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if _, ok := h.sessions[client.ClientID]; ok {
+		return fmt.Errorf("%w: %s", ErrBlazeSessionExists, client.ClientID)
+	}
+
+	s := &blazeSession{
+		handler: &blazeHandler{
+			Client:  client,
+			dialSem: h.dialSem,
+		},
+		status:         BlazeSessionStatus{ClientID: client.ClientID},
+		onLeaderChange: h.onLeaderChange,
+	}
+
+	if h.cfg.Store != nil {
+		s.handler.store = h.cfg.Store(client.ClientID)
+	}
+
+	h.sessions[client.ClientID] = s
+	if h.ctx != nil {
+		h.start(s)
+	}
+
+	return nil
+}
+
+// Remove stops the session of the client and removes it from the hub
+func (h *BlazeHub) Remove(clientID string) bool {
+	h.mux.Lock()
+	s, ok := h.sessions[clientID]
+	delete(h.sessions, clientID)
+	h.mux.Unlock()
+
+	if ok && s.cancel != nil {
+		s.cancel()
+	}
+
+	return ok
+}
+
+// Run loops all sessions until ctx is done
+func (h *BlazeHub) Run(ctx context.Context) error {
+	h.mux.Lock()
+	if h.ctx != nil {
+		h.mux.Unlock()
+		return errors.New("blaze hub is already running")
+	}
+
+	h.ctx = ctx
+	for _, s := range h.sessions {
+		h.start(s)
+	}
+	h.mux.Unlock()
+
+	<-ctx.Done()
+	h.wg.Wait()
+
+	h.mux.Lock()
+	h.ctx = nil
+	h.mux.Unlock()
+
+	return ctx.Err()
+}
+
+func (h *BlazeHub) start(s *blazeSession) {
+	ctx, cancel := context.WithCancel(h.ctx)
+	s.cancel = cancel
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		defer cancel()
+
+		h.run(ctx, s)
+	}()
+}
+
+func (h *BlazeHub) run(ctx context.Context, s *blazeSession) {
+	if err := s.handler.loadPendingAcks(ctx); err != nil {
+		s.setError(err)
+	}
+
+	for {
+		leaderCtx, release, err := h.lead(ctx, s)
+		if err != nil {
+			return
+		}
+
+		h.loop(leaderCtx, s)
+		release()
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// lead blocks until the session becomes the leader of its client,
+// the returned context is cancelled once the lease is lost
+func (h *BlazeHub) lead(ctx context.Context, s *blazeSession) (context.Context, func(), error) {
+	locker := h.cfg.Locker
+	if locker == nil {
+		s.setLeader(true)
+		return ctx, func() { s.setLeader(false) }, nil
+	}
+
+	key, ttl := s.handler.ClientID, h.cfg.LockTTL
+	for {
+		ok, err := locker.Lock(ctx, key, h.cfg.Holder, ttl)
+		if err != nil {
+			s.setError(err)
+		} else if ok {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(ttl / 3):
+		}
+	}
+
+	s.setLeader(true)
+	leaderCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer cancel()
+
+		renewedAt := time.Now()
+		for {
+			select {
+			case <-leaderCtx.Done():
+				return
+			case <-time.After(ttl / 3):
+			}
+
+			ok, err := locker.Lock(leaderCtx, key, h.cfg.Holder, ttl)
+			if err != nil {
+				s.setError(err)
+			} else if ok {
+				renewedAt = time.Now()
+				continue
+			}
+
+			// step down if lost the lease or it's about to expire
+			if (!ok && err == nil) || time.Since(renewedAt) > ttl*2/3 {
+				return
+			}
+		}
+	}()
+
+	release := func() {
+		cancel()
+		<-done
+		s.setLeader(false)
+
+		unlockCtx, cancel := context.WithTimeout(context.Background(), ttl/3)
+		defer cancel()
+		if err := locker.Unlock(unlockCtx, key, h.cfg.Holder); err != nil {
+			s.setError(err)
+		}
+	}
+
+	return leaderCtx, release, nil
+}
+
+func (h *BlazeHub) loop(ctx context.Context, s *blazeSession) {
+	listener := &blazeListenerFuncs{
+		onAckReceipt: h.listener.OnAckReceipt,
+		onMessage: func(ctx context.Context, msg *MessageView, userID string) error {
+			s.touch()
+			return h.listener.OnMessage(ctx, msg, userID)
+		},
+	}
+
+	s.handler.onConnected = s.connected
+	dur := h.cfg.RetryInterval
+
+	for {
+		err := s.handler.loop(ctx, listener, h.cfg.Options...)
+		if ctx.Err() != nil {
+			s.disconnected(nil)
+			return
+		}
+
+		if s.disconnected(err) {
+			dur = h.cfg.RetryInterval
+		} else if dur = dur * 2; dur > maxBlazeHubRetryInterval {
+			dur = maxBlazeHubRetryInterval
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(dur):
+		}
+	}
+}
+
+// Status reports the status of every session, sorted by client id
+func (h *BlazeHub) Status() *BlazeHubStatus {
+	h.mux.Lock()
+	sessions := make([]*blazeSession, 0, len(h.sessions))
+	for _, s := range h.sessions {
+		sessions = append(sessions, s)
+	}
+	h.mux.Unlock()
+
+	status := &BlazeHubStatus{
+		Total:    len(sessions),
+		Sessions: make([]*BlazeSessionStatus, 0, len(sessions)),
+	}
+
+	for _, s := range sessions {
+		s.mux.Lock()
+		st := s.status
+		s.mux.Unlock()
+
+		if st.Connected {
+			status.Connected++
+		} else {
+			status.Disconnected++
+		}
+
+		status.Sessions = append(status.Sessions, &st)
+	}
+
+	sort.Slice(status.Sessions, func(i, j int) bool {
+		return status.Sessions[i].ClientID < status.Sessions[j].ClientID
+	})
+
+	return status
+}
+
+func (s *blazeSession) connected() {
+	now := time.Now()
+	s.mux.Lock()
+	s.status.Connected = true
+	s.status.ConnectedAt = &now
+	s.mux.Unlock()
+}
+
+// disconnected records the error and reports whether the session was connected
+func (s *blazeSession) disconnected(err error) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	wasConnected := s.status.Connected
+	s.status.Connected = false
+	if err != nil {
+		now := time.Now()
+		s.status.LastError = err.Error()
+		s.status.LastErrorAt = &now
+		s.status.Reconnects++
+	}
+
+	return wasConnected
+}
+
+func (s *blazeSession) setLeader(leader bool) {
+	s.mux.Lock()
+	s.status.Leader = leader
+	s.mux.Unlock()
+
+	if s.onLeaderChange != nil {
+		s.onLeaderChange(s.handler.ClientID, leader)
+	}
+}
+
+func (s *blazeSession) setError(err error) {
+	now := time.Now()
+	s.mux.Lock()
+	s.status.LastError = err.Error()
+	s.status.LastErrorAt = &now
+	s.mux.Unlock()
+}
+
+func (s *blazeSession) touch() {
+	now := time.Now()
+	s.mux.Lock()
+	s.status.LastMessageAt = &now
+	s.mux.Unlock()
+}
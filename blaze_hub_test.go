@@ -0,0 +1,54 @@
+package mixin
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlazeHub(t *testing.T) {
+	hub := NewBlazeHub(BlazeListenFunc(func(ctx context.Context, msg *MessageView, userID string) error {
+		return nil
+	}), BlazeHubConfig{})
+
+	a, b := NewFromAccessToken(""), NewFromAccessToken("")
+	a.ClientID, b.ClientID = "b", "a"
+
+	require.NoError(t, hub.AddClient(a))
+	require.NoError(t, hub.AddClient(b))
+	require.True(t, errors.Is(hub.AddClient(a), ErrBlazeSessionExists))
+
+	status := hub.Status()
+	assert.Equal(t, 2, status.Total)
+	assert.Equal(t, 2, status.Disconnected)
+	assert.Equal(t, "a", status.Sessions[0].ClientID)
+
+	assert.True(t, hub.Remove("a"))
+	assert.False(t, hub.Remove("a"))
+	assert.Equal(t, 1, hub.Status().Total)
+}
+
+func TestBlazeHub_Run(t *testing.T) {
+	store := newKeystoreFromEnv(t)
+
+	hub := NewBlazeHub(BlazeListenFunc(func(ctx context.Context, msg *MessageView, userID string) error {
+		t.Log(userID, msg.Category, msg.Data)
+		return nil
+	}), BlazeHubConfig{})
+	require.NoError(t, hub.Add(&store.Keystore))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	go func() {
+		time.Sleep(5 * time.Second)
+		status := hub.Status()
+		assert.Equal(t, 1, status.Connected)
+	}()
+
+	assert.ErrorIs(t, hub.Run(ctx), context.DeadlineExceeded)
+}
@@ -0,0 +1,217 @@
+package mixin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// BlazeLocker grants the lease of a key to one holder at a time, BlazeHub uses it
+// to make sure only one replica consumes blaze messages of a client.
+// It can be backed by redis, etcd or anything supporting compare and set with ttl.
+type BlazeLocker interface {
+	// Lock acquires the lease of key for holder, or renews it if holder already holds it,
+	// it returns false if the lease is held by another holder and not expired
+	Lock(ctx context.Context, key, holder string, ttl time.Duration) (bool, error)
+	// Unlock releases the lease if it is held by holder
+	Unlock(ctx context.Context, key, holder string) error
+}
+
+// LoopBlazeWithLocker is same as LoopBlazeWithStore but consumes the messages only while
+// holding the lease of the client id from locker, so that one of the replicas running it
+// receives the messages and the others take over once it is gone. Unlike LoopBlaze it
+// reconnects after errors, it returns when ctx is done. The store is optional.
+func (c *Client) LoopBlazeWithLocker(ctx context.Context, listener BlazeListener, locker BlazeLocker, store BlazeStore, opts ...BlazeOption) error {
+	hub := NewBlazeHub(listener, BlazeHubConfig{
+		Locker:  locker,
+		Options: opts,
+		Store: func(string) BlazeStore {
+			return store
+		},
+	})
+
+	if err := hub.AddClient(c); err != nil {
+		return err
+	}
+
+	return hub.Run(ctx)
+}
+
+type blazeLease struct {
+	Holder    string    `json:"holder"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+func (l *blazeLease) available(holder string) bool {
+	return l.Holder == "" || l.Holder == holder || time.Now().After(l.ExpiredAt)
+}
+
+type memoryBlazeLocker struct {
+	leases map[string]blazeLease
+	mux    sync.Mutex
+}
+
+// NewMemoryBlazeLocker returns a BlazeLocker shared in the process
+func NewMemoryBlazeLocker() BlazeLocker {
+	return &memoryBlazeLocker{
+		leases: make(map[string]blazeLease),
+	}
+}
+
+func (m *memoryBlazeLocker) Lock(_ context.Context, key, holder string, ttl time.Duration) (bool, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	lease := m.leases[key]
+	if !lease.available(holder) {
+		return false, nil
+	}
+
+	m.leases[key] = blazeLease{
+		Holder:    holder,
+		ExpiredAt: time.Now().Add(ttl),
+	}
+
+	return true, nil
+}
+
+func (m *memoryBlazeLocker) Unlock(_ context.Context, key, holder string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	if lease := m.leases[key]; lease.Holder == holder {
+		delete(m.leases, key)
+	}
+
+	return nil
+}
+
+const fileBlazeLockerGuardTimeout = 10 * time.Second
+
+type fileBlazeLocker struct {
+	dir string
+}
+
+// NewFileBlazeLocker returns a BlazeLocker keeping leases as files in dir,
+// it works for processes sharing the same file system
+func NewFileBlazeLocker(dir string) (BlazeLocker, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &fileBlazeLocker{dir: dir}, nil
+}
+
+func (f *fileBlazeLocker) path(key string) string {
+	return filepath.Join(f.dir, uuidHash([]byte(key))+".lease")
+}
+
+// guard creates the guard file exclusively to serialize lease updates between processes,
+// a guard left by a crashed process is removed after fileBlazeLockerGuardTimeout
+func (f *fileBlazeLocker) guard(ctx context.Context, key string) (func(), error) {
+	path := f.path(key) + ".guard"
+
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_ = file.Close()
+			return func() { _ = os.Remove(path) }, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > fileBlazeLockerGuardTimeout {
+			_ = os.Remove(path)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func (f *fileBlazeLocker) read(key string) (*blazeLease, error) {
+	var lease blazeLease
+
+	b, err := os.ReadFile(f.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &lease, nil
+		}
+
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &lease); err != nil {
+		return nil, err
+	}
+
+	return &lease, nil
+}
+
+func (f *fileBlazeLocker) Lock(ctx context.Context, key, holder string, ttl time.Duration) (bool, error) {
+	release, err := f.guard(ctx, key)
+	if err != nil {
+		return false, err
+	}
+
+	defer release()
+
+	lease, err := f.read(key)
+	if err != nil {
+		return false, err
+	}
+
+	if !lease.available(holder) {
+		return false, nil
+	}
+
+	b, _ := json.Marshal(blazeLease{
+		Holder:    holder,
+		ExpiredAt: time.Now().Add(ttl),
+	})
+
+	path := f.path(key)
+	if err := os.WriteFile(path+".tmp", b, 0o600); err != nil {
+		return false, err
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (f *fileBlazeLocker) Unlock(ctx context.Context, key, holder string) error {
+	release, err := f.guard(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	defer release()
+
+	lease, err := f.read(key)
+	if err != nil {
+		return err
+	}
+
+	if lease.Holder != holder {
+		return nil
+	}
+
+	if err := os.Remove(f.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package mixin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBlazeLocker(t *testing.T, locker BlazeLocker) {
+	ctx := context.Background()
+	key := newUUID()
+	ttl := 50 * time.Millisecond
+
+	ok, err := locker.Lock(ctx, key, "a", ttl)
+	require.NoError(t, err)
+	assert.True(t, ok, "a acquires")
+
+	ok, err = locker.Lock(ctx, key, "b", ttl)
+	require.NoError(t, err)
+	assert.False(t, ok, "b waits")
+
+	ok, err = locker.Lock(ctx, key, "a", ttl)
+	require.NoError(t, err)
+	assert.True(t, ok, "a renews")
+
+	time.Sleep(ttl)
+	ok, err = locker.Lock(ctx, key, "b", ttl)
+	require.NoError(t, err)
+	assert.True(t, ok, "b takes over")
+
+	require.NoError(t, locker.Unlock(ctx, key, "a"))
+	ok, err = locker.Lock(ctx, key, "a", ttl)
+	require.NoError(t, err)
+	assert.False(t, ok, "a can't release the lease of b")
+
+	require.NoError(t, locker.Unlock(ctx, key, "b"))
+	ok, err = locker.Lock(ctx, key, "a", ttl)
+	require.NoError(t, err)
+	assert.True(t, ok, "released by b")
+}
+
+func TestMemoryBlazeLocker(t *testing.T) {
+	testBlazeLocker(t, NewMemoryBlazeLocker())
+}
+
+func TestFileBlazeLocker(t *testing.T) {
+	locker, err := NewFileBlazeLocker(t.TempDir())
+	require.NoError(t, err)
+	testBlazeLocker(t, locker)
+}
+
+// deniedBlazeLocker reports the holders denied by the locker
+type deniedBlazeLocker struct {
+	BlazeLocker
+	denied chan string
+}
+
+func (l *deniedBlazeLocker) Lock(ctx context.Context, key, holder string, ttl time.Duration) (bool, error) {
+	ok, err := l.BlazeLocker.Lock(ctx, key, holder, ttl)
+	if !ok && err == nil {
+		select {
+		case l.denied <- holder:
+		default:
+		}
+	}
+
+	return ok, err
+}
+
+func TestBlazeHub_Locker(t *testing.T) {
+	listener := BlazeListenFunc(func(ctx context.Context, msg *MessageView, userID string) error {
+		return nil
+	})
+
+	locker := &deniedBlazeLocker{BlazeLocker: NewMemoryBlazeLocker(), denied: make(chan string, 1)}
+	newHub := func(holder string) (*BlazeHub, chan bool) {
+		hub := NewBlazeHub(listener, BlazeHubConfig{
+			Locker:        locker,
+			LockTTL:       300 * time.Millisecond,
+			RetryInterval: time.Hour,
+			Holder:        holder,
+		})
+
+		leaderChanges := make(chan bool, 8)
+		hub.onLeaderChange = func(_ string, leader bool) {
+			leaderChanges <- leader
+		}
+
+		client := NewFromAccessToken("")
+		client.ClientID = "bot"
+		require.NoError(t, hub.AddClient(client))
+		return hub, leaderChanges
+	}
+
+	receive := func(ch <-chan bool) bool {
+		select {
+		case v := <-ch:
+			return v
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timeout")
+			return false
+		}
+	}
+
+	leader, leaderChanges := newHub("leader")
+	follower, followerChanges := newHub("follower")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	leaderCtx, stopLeader := context.WithCancel(ctx)
+	go leader.Run(leaderCtx)
+	require.True(t, receive(leaderChanges), "leader elected")
+
+	go follower.Run(ctx)
+	select {
+	case holder := <-locker.denied:
+		assert.Equal(t, "follower", holder)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "timeout")
+	}
+
+	assert.True(t, leader.Status().Sessions[0].Leader)
+	assert.False(t, follower.Status().Sessions[0].Leader)
+
+	stopLeader()
+	assert.False(t, receive(leaderChanges), "leader steps down")
+	assert.True(t, receive(followerChanges), "follower takes over")
+	assert.False(t, leader.Status().Sessions[0].Leader)
+	assert.True(t, follower.Status().Sessions[0].Leader)
+}
+
+func TestClient_LoopBlazeWithLocker(t *testing.T) {
+	locker := NewMemoryBlazeLocker()
+	ok, err := locker.Lock(context.Background(), "bot", "other", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	client := NewFromAccessToken("")
+	client.ClientID = "bot"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// waits for the lease held by another replica until ctx is done
+	err = client.LoopBlazeWithLocker(ctx, BlazeListenFunc(func(ctx context.Context, msg *MessageView, userID string) error {
+		return nil
+	}), locker, nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,234 @@
+package mixin
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"math"
+	"runtime/debug"
+	"time"
+)
+
+// BlazeMiddleware wraps a BlazeListener with extra behaviour
+type BlazeMiddleware func(next BlazeListener) BlazeListener
+
+// WrapBlazeListener applies middlewares to the listener,
+// the first middleware is the outermost one
+func WrapBlazeListener(listener BlazeListener, middlewares ...BlazeMiddleware) BlazeListener {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		listener = middlewares[i](listener)
+	}
+
+	return listener
+}
+
+type blazeListenerFuncs struct {
+	onAckReceipt func(ctx context.Context, msg *MessageView, userID string) error
+	onMessage    func(ctx context.Context, msg *MessageView, userID string) error
+}
+
+func (l *blazeListenerFuncs) OnAckReceipt(ctx context.Context, msg *MessageView, userID string) error {
+	return l.onAckReceipt(ctx, msg, userID)
+}
+
+func (l *blazeListenerFuncs) OnMessage(ctx context.Context, msg *MessageView, userID string) error {
+	return l.onMessage(ctx, msg, userID)
+}
+
+// BlazeRecoverPolicy decides what happens to a message whose handler panicked
+type BlazeRecoverPolicy int
+
+const (
+	// BlazeRecoverReturnError returns the panic as an error and stops the loop
+	BlazeRecoverReturnError BlazeRecoverPolicy = iota
+	// BlazeRecoverAck drops the message, it will be acked as usual
+	BlazeRecoverAck
+	// BlazeRecoverRedeliver leaves the message unacked and not marked as handled in the BlazeStore,
+	// so it will be redelivered and handled again after reconnecting
+	BlazeRecoverRedeliver
+)
+
+// BlazePanicError is the error recovered from a panic in the listener
+type BlazePanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *BlazePanicError) Error() string {
+	return fmt.Sprintf("blaze listener panic: %v", e.Value)
+}
+
+// BlazeRecover recovers panics in the listener and applies the policy,
+// onPanic is optional and called with the recovered *BlazePanicError
+func BlazeRecover(policy BlazeRecoverPolicy, onPanic func(ctx context.Context, msg *MessageView, err error)) BlazeMiddleware {
+	protect := func(handle func(ctx context.Context, msg *MessageView, userID string) error) func(ctx context.Context, msg *MessageView, userID string) error {
+		return func(ctx context.Context, msg *MessageView, userID string) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					e := &BlazePanicError{Value: r, Stack: debug.Stack()}
+					if onPanic != nil {
+						onPanic(ctx, msg, e)
+					}
+
+					switch policy {
+					case BlazeRecoverAck:
+						err = nil
+					case BlazeRecoverRedeliver:
+						msg.Ack()
+						msg.redeliver = true
+						err = nil
+					default:
+						err = e
+					}
+				}
+			}()
+
+			return handle(ctx, msg, userID)
+		}
+	}
+
+	return func(next BlazeListener) BlazeListener {
+		return &blazeListenerFuncs{
+			onAckReceipt: protect(next.OnAckReceipt),
+			onMessage:    protect(next.OnMessage),
+		}
+	}
+}
+
+// BlazeLogger logs every message handled by the listener
+func BlazeLogger(logger *slog.Logger) BlazeMiddleware {
+	log := func(action string, handle func(ctx context.Context, msg *MessageView, userID string) error) func(ctx context.Context, msg *MessageView, userID string) error {
+		return func(ctx context.Context, msg *MessageView, userID string) error {
+			start := time.Now()
+			attrs := []slog.Attr{
+				slog.String("action", action),
+				slog.String("message_id", msg.MessageID),
+				slog.String("conversation_id", msg.ConversationID),
+				slog.String("user_id", msg.UserID),
+				slog.String("category", msg.Category),
+			}
+
+			err := handle(ctx, msg, userID)
+			attrs = append(attrs, slog.Duration("duration", time.Since(start)))
+			if err != nil {
+				attrs = append(attrs, slog.Any("error", err))
+				logger.LogAttrs(ctx, slog.LevelError, "handle blaze message failed", attrs...)
+			} else {
+				logger.LogAttrs(ctx, slog.LevelDebug, "handle blaze message", attrs...)
+			}
+
+			return err
+		}
+	}
+
+	return func(next BlazeListener) BlazeListener {
+		return &blazeListenerFuncs{
+			onAckReceipt: log(AcknowledgeReceiptAction, next.OnAckReceipt),
+			onMessage:    log(CreateMessageAction, next.OnMessage),
+		}
+	}
+}
+
+// BlazeTimeout limits the time of handling one message by the context deadline
+func BlazeTimeout(timeout time.Duration) BlazeMiddleware {
+	return func(next BlazeListener) BlazeListener {
+		return &blazeListenerFuncs{
+			onAckReceipt: next.OnAckReceipt,
+			onMessage: func(ctx context.Context, msg *MessageView, userID string) error {
+				ctx, cancel := context.WithTimeout(ctx, timeout)
+				defer cancel()
+
+				return next.OnMessage(ctx, msg, userID)
+			},
+		}
+	}
+}
+
+// BlazeFilter passes messages to the listener only if accept returns true,
+// other messages are skipped and acked
+func BlazeFilter(accept func(msg *MessageView, userID string) bool) BlazeMiddleware {
+	return func(next BlazeListener) BlazeListener {
+		return &blazeListenerFuncs{
+			onAckReceipt: next.OnAckReceipt,
+			onMessage: func(ctx context.Context, msg *MessageView, userID string) error {
+				if !accept(msg, userID) {
+					return nil
+				}
+
+				return next.OnMessage(ctx, msg, userID)
+			},
+		}
+	}
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+
+	return set
+}
+
+// BlazeIgnoreSelf skips messages sent by the bot itself or by its representative
+func BlazeIgnoreSelf() BlazeMiddleware {
+	return BlazeFilter(func(msg *MessageView, userID string) bool {
+		return msg.UserID != userID && msg.RepresentativeID != userID
+	})
+}
+
+// BlazeIgnoreUsers skips messages sent by the given users
+func BlazeIgnoreUsers(userIDs ...string) BlazeMiddleware {
+	set := stringSet(userIDs)
+	return BlazeFilter(func(msg *MessageView, _ string) bool {
+		return !set[msg.UserID]
+	})
+}
+
+// BlazeOnlyCategories passes only messages of the given categories
+func BlazeOnlyCategories(categories ...string) BlazeMiddleware {
+	set := stringSet(categories)
+	return BlazeFilter(func(msg *MessageView, _ string) bool {
+		return set[msg.Category]
+	})
+}
+
+// BlazeIgnoreCategories skips messages of the given categories
+func BlazeIgnoreCategories(categories ...string) BlazeMiddleware {
+	set := stringSet(categories)
+	return BlazeFilter(func(msg *MessageView, _ string) bool {
+		return !set[msg.Category]
+	})
+}
+
+// BlazeOnlyConversations passes only messages of the given conversations
+func BlazeOnlyConversations(conversationIDs ...string) BlazeMiddleware {
+	set := stringSet(conversationIDs)
+	return BlazeFilter(func(msg *MessageView, _ string) bool {
+		return set[msg.ConversationID]
+	})
+}
+
+// BlazeIgnoreConversations skips messages of the given conversations
+func BlazeIgnoreConversations(conversationIDs ...string) BlazeMiddleware {
+	set := stringSet(conversationIDs)
+	return BlazeFilter(func(msg *MessageView, _ string) bool {
+		return !set[msg.ConversationID]
+	})
+}
+
+// BlazeSample passes about rate (0 to 1) of all messages to the listener,
+// a message is always sampled the same way, redelivered or not
+func BlazeSample(rate float64) BlazeMiddleware {
+	return BlazeFilter(func(msg *MessageView, _ string) bool {
+		if rate >= 1 {
+			return true
+		}
+
+		sum := md5.Sum([]byte(msg.MessageID))
+		v := binary.BigEndian.Uint64(sum[:8])
+		return float64(v) < rate*math.MaxUint64
+	})
+}
@@ -0,0 +1,151 @@
+package mixin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlazeRecover(t *testing.T) {
+	ctx := context.Background()
+	listener := BlazeListenFunc(func(ctx context.Context, msg *MessageView, userID string) error {
+		panic("boom")
+	})
+
+	t.Run("return error", func(t *testing.T) {
+		var msg MessageView
+		err := WrapBlazeListener(listener, BlazeRecover(BlazeRecoverReturnError, nil)).OnMessage(ctx, &msg, "")
+		var e *BlazePanicError
+		require.True(t, errors.As(err, &e))
+		assert.Equal(t, "boom", e.Value)
+	})
+
+	t.Run("ack", func(t *testing.T) {
+		var (
+			msg     MessageView
+			reports int
+		)
+
+		err := WrapBlazeListener(listener, BlazeRecover(BlazeRecoverAck, func(ctx context.Context, msg *MessageView, err error) {
+			reports++
+		})).OnMessage(ctx, &msg, "")
+		require.NoError(t, err)
+		assert.False(t, msg.ack)
+		assert.Equal(t, 1, reports)
+	})
+
+	t.Run("redeliver", func(t *testing.T) {
+		var msg MessageView
+		err := WrapBlazeListener(listener, BlazeRecover(BlazeRecoverRedeliver, nil)).OnMessage(ctx, &msg, "")
+		require.NoError(t, err)
+		assert.True(t, msg.ack, "auto ack should be skipped")
+	})
+}
+
+func TestBlazeRecoverRedeliverWithStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryBlazeStore(0)
+	b := &blazeHandler{Client: newClient(newUUID()), store: store}
+
+	var calls int
+	listener := WrapBlazeListener(BlazeListenFunc(func(ctx context.Context, msg *MessageView, userID string) error {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+
+		return nil
+	}), BlazeRecover(BlazeRecoverRedeliver, nil))
+
+	messageID := newUUID()
+	deliver := func() {
+		msg := MessageView{MessageID: messageID}
+		require.NoError(t, b.handleMessage(ctx, listener, &msg))
+	}
+
+	deliver()
+	handled, err := store.IsHandled(ctx, messageID)
+	require.NoError(t, err)
+	assert.False(t, handled, "left for redelivery")
+	assert.Empty(t, b.queue.pull(ackBatch), "not acked")
+
+	// redelivered after reconnecting
+	deliver()
+	assert.Equal(t, 2, calls, "handled again")
+	handled, err = store.IsHandled(ctx, messageID)
+	require.NoError(t, err)
+	assert.True(t, handled)
+	assert.Len(t, b.queue.pull(ackBatch), 1)
+
+	// redelivered again before the ack arrives
+	deliver()
+	assert.Equal(t, 2, calls, "handled only once")
+	assert.Len(t, b.queue.pull(ackBatch), 1, "acked again")
+}
+
+func TestBlazeFilters(t *testing.T) {
+	ctx := context.Background()
+	botID, userID, blockedID := newUUID(), newUUID(), newUUID()
+
+	var handled []string
+	listener := WrapBlazeListener(
+		BlazeListenFunc(func(ctx context.Context, msg *MessageView, _ string) error {
+			handled = append(handled, msg.MessageID)
+			return nil
+		}),
+		BlazeIgnoreSelf(),
+		BlazeIgnoreUsers(blockedID),
+		BlazeOnlyCategories(MessageCategoryPlainText),
+	)
+
+	messages := []*MessageView{
+		{MessageID: "1", UserID: userID, Category: MessageCategoryPlainText},
+		{MessageID: "2", UserID: botID, Category: MessageCategoryPlainText},
+		{MessageID: "3", UserID: userID, RepresentativeID: botID, Category: MessageCategoryPlainText},
+		{MessageID: "4", UserID: blockedID, Category: MessageCategoryPlainText},
+		{MessageID: "5", UserID: userID, Category: MessageCategoryPlainImage},
+	}
+
+	for _, msg := range messages {
+		require.NoError(t, listener.OnMessage(ctx, msg, botID))
+	}
+
+	assert.Equal(t, []string{"1"}, handled)
+}
+
+func TestBlazeSample(t *testing.T) {
+	ctx := context.Background()
+
+	var count int
+	listener := WrapBlazeListener(BlazeListenFunc(func(ctx context.Context, msg *MessageView, _ string) error {
+		count++
+		return nil
+	}), BlazeSample(0.5))
+
+	const total = 1000
+	for i := 0; i < total; i++ {
+		require.NoError(t, listener.OnMessage(ctx, &MessageView{MessageID: newUUID()}, ""))
+	}
+
+	assert.InDelta(t, total/2, count, total/10)
+}
+
+func TestBlazeTimeoutAndLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	listener := WrapBlazeListener(BlazeListenFunc(func(ctx context.Context, msg *MessageView, _ string) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), BlazeLogger(logger), BlazeTimeout(10*time.Millisecond))
+
+	err := listener.OnMessage(context.Background(), &MessageView{MessageID: newUUID()}, "")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, buf.String(), "handle blaze message failed")
+}
@@ -0,0 +1,236 @@
+package mixin
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultBlazeStoreTTL = 24 * time.Hour
+
+// BlazeStore keeps track of handled blaze messages and the acknowledgements
+// not sent yet, so that messages redelivered after reconnecting or restarting
+// are handled only once.
+type BlazeStore interface {
+	// IsHandled reports whether the message has already been handled
+	IsHandled(ctx context.Context, messageID string) (bool, error)
+	// MarkHandled records the message as handled
+	MarkHandled(ctx context.Context, messageID string) error
+	// AddPendingAcks saves acknowledgements waiting to be sent
+	AddPendingAcks(ctx context.Context, requests []*AcknowledgementRequest) error
+	// RemovePendingAcks drops acknowledgements that have been sent
+	RemovePendingAcks(ctx context.Context, requests []*AcknowledgementRequest) error
+	// ListPendingAcks returns all acknowledgements waiting to be sent
+	ListPendingAcks(ctx context.Context) ([]*AcknowledgementRequest, error)
+}
+
+type memoryBlazeStore struct {
+	ttl      time.Duration
+	prunedAt time.Time
+	handled  map[string]time.Time
+	pending  map[string]*AcknowledgementRequest
+	mux      sync.Mutex
+}
+
+// NewMemoryBlazeStore returns a BlazeStore living in memory,
+// handled message ids are forgotten after ttl, default is 24 hours
+func NewMemoryBlazeStore(ttl time.Duration) BlazeStore {
+	return newMemoryBlazeStore(ttl)
+}
+
+func newMemoryBlazeStore(ttl time.Duration) *memoryBlazeStore {
+	if ttl <= 0 {
+		ttl = defaultBlazeStoreTTL
+	}
+
+	return &memoryBlazeStore{
+		ttl:      ttl,
+		prunedAt: time.Now(),
+		handled:  make(map[string]time.Time),
+		pending:  make(map[string]*AcknowledgementRequest),
+	}
+}
+
+func (s *memoryBlazeStore) IsHandled(_ context.Context, messageID string) (bool, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	at, ok := s.handled[messageID]
+	return ok && time.Since(at) < s.ttl, nil
+}
+
+func (s *memoryBlazeStore) MarkHandled(_ context.Context, messageID string) error {
+	s.mux.Lock()
+	s.markHandled(messageID, time.Now())
+	s.mux.Unlock()
+	return nil
+}
+
+func (s *memoryBlazeStore) markHandled(messageID string, at time.Time) {
+	s.handled[messageID] = at
+
+	if now := time.Now(); now.Sub(s.prunedAt) > s.ttl/10 {
+		for id, at := range s.handled {
+			if now.Sub(at) >= s.ttl {
+				delete(s.handled, id)
+			}
+		}
+
+		s.prunedAt = now
+	}
+}
+
+func (s *memoryBlazeStore) AddPendingAcks(_ context.Context, requests []*AcknowledgementRequest) error {
+	s.mux.Lock()
+	for _, req := range requests {
+		s.pending[req.MessageID] = req
+	}
+	s.mux.Unlock()
+	return nil
+}
+
+func (s *memoryBlazeStore) RemovePendingAcks(_ context.Context, requests []*AcknowledgementRequest) error {
+	s.mux.Lock()
+	for _, req := range requests {
+		delete(s.pending, req.MessageID)
+	}
+	s.mux.Unlock()
+	return nil
+}
+
+func (s *memoryBlazeStore) ListPendingAcks(_ context.Context) ([]*AcknowledgementRequest, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	requests := make([]*AcknowledgementRequest, 0, len(s.pending))
+	for _, req := range s.pending {
+		requests = append(requests, req)
+	}
+
+	return requests, nil
+}
+
+const (
+	blazeJournalHandled = "handled"
+	blazeJournalAck     = "ack"
+	blazeJournalAcked   = "acked"
+)
+
+type blazeJournalEntry struct {
+	Op        string    `json:"op"`
+	MessageID string    `json:"message_id"`
+	Status    string    `json:"status,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// FileBlazeStore is a BlazeStore persisted as an append only journal file
+type FileBlazeStore struct {
+	*memoryBlazeStore
+	journal *journal[blazeJournalEntry]
+}
+
+// NewFileBlazeStore opens the journal file at path,
+// the journal is compacted every time the store is opened
+func NewFileBlazeStore(path string, ttl time.Duration) (*FileBlazeStore, error) {
+	s := &FileBlazeStore{
+		memoryBlazeStore: newMemoryBlazeStore(ttl),
+	}
+
+	j, err := openJournal(path, 0, s.apply, s.snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	s.journal = j
+	return s, nil
+}
+
+func (s *FileBlazeStore) apply(entry blazeJournalEntry) {
+	switch entry.Op {
+	case blazeJournalHandled:
+		if time.Since(entry.At) < s.ttl {
+			s.handled[entry.MessageID] = entry.At
+		}
+	case blazeJournalAck:
+		s.pending[entry.MessageID] = &AcknowledgementRequest{
+			MessageID: entry.MessageID,
+			Status:    entry.Status,
+		}
+	case blazeJournalAcked:
+		delete(s.pending, entry.MessageID)
+	}
+}
+
+func (s *FileBlazeStore) snapshot() []blazeJournalEntry {
+	var entries []blazeJournalEntry
+	for id, at := range s.handled {
+		entries = append(entries, blazeJournalEntry{Op: blazeJournalHandled, MessageID: id, At: at})
+	}
+
+	for _, req := range s.pending {
+		entries = append(entries, blazeJournalEntry{Op: blazeJournalAck, MessageID: req.MessageID, Status: req.Status})
+	}
+
+	return entries
+}
+
+func (s *FileBlazeStore) MarkHandled(_ context.Context, messageID string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	now := time.Now()
+	if err := s.journal.write(blazeJournalEntry{Op: blazeJournalHandled, MessageID: messageID, At: now}); err != nil {
+		return err
+	}
+
+	s.markHandled(messageID, now)
+	return nil
+}
+
+func (s *FileBlazeStore) AddPendingAcks(_ context.Context, requests []*AcknowledgementRequest) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	entries := make([]blazeJournalEntry, len(requests))
+	for i, req := range requests {
+		entries[i] = blazeJournalEntry{Op: blazeJournalAck, MessageID: req.MessageID, Status: req.Status, At: time.Now()}
+	}
+
+	if err := s.journal.write(entries...); err != nil {
+		return err
+	}
+
+	for _, req := range requests {
+		s.pending[req.MessageID] = req
+	}
+
+	return nil
+}
+
+func (s *FileBlazeStore) RemovePendingAcks(_ context.Context, requests []*AcknowledgementRequest) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	entries := make([]blazeJournalEntry, len(requests))
+	for i, req := range requests {
+		entries[i] = blazeJournalEntry{Op: blazeJournalAcked, MessageID: req.MessageID, At: time.Now()}
+	}
+
+	if err := s.journal.write(entries...); err != nil {
+		return err
+	}
+
+	for _, req := range requests {
+		delete(s.pending, req.MessageID)
+	}
+
+	return nil
+}
+
+// Close closes the journal file
+func (s *FileBlazeStore) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.journal.Close()
+}
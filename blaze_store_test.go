@@ -0,0 +1,62 @@
+package mixin
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testBlazeStore(t *testing.T, store BlazeStore) {
+	ctx := context.Background()
+	messageID := newUUID()
+
+	handled, err := store.IsHandled(ctx, messageID)
+	require.NoError(t, err)
+	require.False(t, handled)
+
+	require.NoError(t, store.MarkHandled(ctx, messageID))
+	handled, err = store.IsHandled(ctx, messageID)
+	require.NoError(t, err)
+	require.True(t, handled)
+
+	acks := []*AcknowledgementRequest{
+		{MessageID: messageID, Status: MessageStatusRead},
+		{MessageID: newUUID(), Status: MessageStatusRead},
+	}
+	require.NoError(t, store.AddPendingAcks(ctx, acks))
+	require.NoError(t, store.RemovePendingAcks(ctx, acks[:1]))
+
+	pending, err := store.ListPendingAcks(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	require.Equal(t, acks[1].MessageID, pending[0].MessageID)
+}
+
+func TestMemoryBlazeStore(t *testing.T) {
+	testBlazeStore(t, NewMemoryBlazeStore(0))
+}
+
+func TestFileBlazeStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "blaze.journal")
+
+	store, err := NewFileBlazeStore(path, 0)
+	require.NoError(t, err)
+	testBlazeStore(t, store)
+
+	expect, err := store.ListPendingAcks(ctx)
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	t.Run("reopen", func(t *testing.T) {
+		store, err := NewFileBlazeStore(path, 0)
+		require.NoError(t, err)
+		defer store.Close()
+
+		pending, err := store.ListPendingAcks(ctx)
+		require.NoError(t, err)
+		require.Equal(t, expect, pending)
+	})
+}
@@ -0,0 +1,110 @@
+package mixin
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// journal is an append only file of json lines backing the file stores,
+// the state is rebuilt by replaying the entries when it is opened
+type journal[T any] struct {
+	f *os.File
+}
+
+// openJournal replays the entries of the journal at path with apply, then compacts
+// it to the entries returned by snapshot and opens it for appending. Lines longer
+// than maxLineSize are not supported, default is bufio.MaxScanTokenSize.
+func openJournal[T any](path string, maxLineSize int, apply func(entry T), snapshot func() []T) (*journal[T], error) {
+	if err := loadJournal(path, maxLineSize, apply); err != nil {
+		return nil, err
+	}
+
+	if err := compactJournal(path, snapshot()); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &journal[T]{f: f}, nil
+}
+
+func loadJournal[T any](path string, maxLineSize int, apply func(entry T)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if maxLineSize > bufio.MaxScanTokenSize {
+		scanner.Buffer(make([]byte, bufio.MaxScanTokenSize), maxLineSize)
+	}
+
+	for scanner.Scan() {
+		var entry T
+		// skip the broken tail left by a crash
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+
+		apply(entry)
+	}
+
+	return scanner.Err()
+}
+
+// compactJournal replaces the journal at path with the entries through a temp file
+func compactJournal[T any](path string, entries []T) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if err := writeJournal(tmp, entries...); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func writeJournal[T any](f *os.File, entries ...T) error {
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+// write appends the entries and syncs them to disk
+func (j *journal[T]) write(entries ...T) error {
+	return writeJournal(j.f, entries...)
+}
+
+func (j *journal[T]) Close() error {
+	return j.f.Close()
+}
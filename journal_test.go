@@ -0,0 +1,52 @@
+package mixin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal(t *testing.T) {
+	type entry struct {
+		Key   string `json:"key"`
+		Value int    `json:"value"`
+	}
+
+	path := filepath.Join(t.TempDir(), "journal")
+	open := func() (map[string]int, *journal[entry]) {
+		state := map[string]int{}
+		j, err := openJournal(path, 0, func(e entry) {
+			state[e.Key] = e.Value
+		}, func() []entry {
+			var entries []entry
+			for k, v := range state {
+				entries = append(entries, entry{Key: k, Value: v})
+			}
+			return entries
+		})
+		require.NoError(t, err)
+		return state, j
+	}
+
+	state, j := open()
+	assert.Empty(t, state)
+	require.NoError(t, j.write(entry{"a", 1}, entry{"b", 2}, entry{"a", 3}))
+	require.NoError(t, j.Close())
+
+	// a broken tail left by a crash
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, _ = f.WriteString(`{"key":"c","val`)
+	require.NoError(t, f.Close())
+
+	state, j = open()
+	assert.Equal(t, map[string]int{"a": 3, "b": 2}, state)
+	require.NoError(t, j.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"c"`, "compacted")
+}
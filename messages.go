@@ -2,8 +2,6 @@ package mixin
 
 import (
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
 	"encoding/json"
 	"time"
 )
@@ -61,8 +59,9 @@ type (
 	}
 
 	StickerMessage struct {
-		Name    string `json:"name,omitempty"`
-		AlbumID string `json:"album_id,omitempty"`
+		StickerID string `json:"sticker_id,omitempty"`
+		Name      string `json:"name,omitempty"`
+		AlbumID   string `json:"album_id,omitempty"`
 	}
 
 	ContactMessage struct {
@@ -177,15 +176,37 @@ type (
 	}
 )
 
+// fillConversationID uses the contact conversation with the recipient if the conversation id is empty,
+// used by the helpers sending messages built on behalf of the client
+func (c *Client) fillConversationID(message *MessageRequest) {
+	if message.ConversationID == "" && c.ClientID != "" {
+		message.ConversationID = UniqueConversationID(c.ClientID, message.RecipientID)
+	}
+}
+
+// withConversationID returns a copy of the message with the contact conversation id
+// filled if it is empty, the message itself is never modified
+func (c *Client) withConversationID(message *MessageRequest) *MessageRequest {
+	if message.ConversationID != "" || c.ClientID == "" {
+		return message
+	}
+
+	msg := *message
+	c.fillConversationID(&msg)
+	return &msg
+}
+
+// SendMessage sends the message, the contact conversation with the recipient is used
+// if the conversation id is empty
 func (c *Client) SendMessage(ctx context.Context, message *MessageRequest) error {
-	raw, _ := json.Marshal(message)
+	raw, _ := json.Marshal(c.withConversationID(message))
 	return c.SendRawMessage(ctx, raw)
 }
 
 func (c *Client) SendMessages(ctx context.Context, messages []*MessageRequest) error {
 	raws := make([]json.RawMessage, 0, len(messages))
 	for _, msg := range messages {
-		b, _ := json.Marshal(msg)
+		b, _ := json.Marshal(c.withConversationID(msg))
 		raws = append(raws, b)
 	}
 
@@ -199,16 +220,3 @@ func (c *Client) SendRawMessage(ctx context.Context, message json.RawMessage) er
 func (c *Client) SendRawMessages(ctx context.Context, messages []json.RawMessage) error {
 	return c.Post(ctx, "/messages", messages, nil)
 }
-
-func DecryptAttachment(data, keys, digest []byte) ([]byte, error) {
-	aesKey := keys[:32]
-	iv := data[:16]
-	ciphertext := data[16 : len(data)-32]
-	block, err := aes.NewCipher(aesKey)
-	if err != nil {
-		return nil, err
-	}
-	mode := cipher.NewCBCDecrypter(block, iv)
-	mode.CryptBlocks(ciphertext, ciphertext)
-	return ciphertext, nil
-}
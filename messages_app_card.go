@@ -0,0 +1,193 @@
+package mixin
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxAppCardTitleLength       = 36
+	maxAppCardDescriptionLength = 128
+	maxAppButtonLabelLength     = 64
+	maxAppButtons               = 16
+
+	// actionInputPrefix sends the text after it as a message when the button is clicked
+	actionInputPrefix = "input:"
+)
+
+var colorRegexp = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// ValidateAction checks the action is an input action, a http(s) url or a mixin scheme
+func ValidateAction(action string) error {
+	if action == "" {
+		return invalidMessageError("empty action")
+	}
+
+	if strings.HasPrefix(action, actionInputPrefix) {
+		if len(action) == len(actionInputPrefix) {
+			return invalidMessageError("empty input action")
+		}
+
+		return nil
+	}
+
+	u, err := url.Parse(action)
+	if err != nil {
+		return invalidMessageError("invalid action %q", action)
+	}
+
+	switch u.Scheme {
+	case "https", "http":
+		if u.Host == "" {
+			return invalidMessageError("invalid action %q: empty host", action)
+		}
+	case Scheme:
+		if u.Host == "" {
+			return invalidMessageError("invalid action %q: empty scheme host", action)
+		}
+	default:
+		return invalidMessageError("invalid action %q: scheme %q not allowed", action, u.Scheme)
+	}
+
+	return nil
+}
+
+// ValidateColor checks the color is in #RRGGBB format, empty is allowed
+func ValidateColor(color string) error {
+	if color != "" && !colorRegexp.MatchString(color) {
+		return invalidMessageError("invalid color %q", color)
+	}
+
+	return nil
+}
+
+func validateImageURL(name, s string) error {
+	if s == "" {
+		return nil
+	}
+
+	if u, err := url.Parse(s); err != nil || u.Scheme != "https" || u.Host == "" {
+		return invalidMessageError("invalid %s %q", name, s)
+	}
+
+	return nil
+}
+
+func (b AppButtonMessage) Validate() error {
+	if b.Label == "" {
+		return invalidMessageError("empty button label")
+	}
+
+	if n := utf8.RuneCountInString(b.Label); n > maxAppButtonLabelLength {
+		return invalidMessageError("button label too long: %d", n)
+	}
+
+	if err := ValidateAction(b.Action); err != nil {
+		return err
+	}
+
+	return ValidateColor(b.Color)
+}
+
+func (g AppButtonGroupMessage) Validate() error {
+	if len(g) == 0 {
+		return invalidMessageError("empty buttons")
+	}
+
+	if len(g) > maxAppButtons {
+		return invalidMessageError("too many buttons: %d", len(g))
+	}
+
+	for idx, button := range g {
+		if err := button.Validate(); err != nil {
+			return fmt.Errorf("button %d: %w", idx, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *AppCardMessage) Validate() error {
+	if c.AppID == "" {
+		return invalidMessageError("empty app id")
+	}
+
+	if c.Title == "" || c.Description == "" {
+		return invalidMessageError("app card title and description required")
+	}
+
+	if n := utf8.RuneCountInString(c.Title); n > maxAppCardTitleLength {
+		return invalidMessageError("app card title too long: %d", n)
+	}
+
+	if n := utf8.RuneCountInString(c.Description); n > maxAppCardDescriptionLength {
+		return invalidMessageError("app card description too long: %d", n)
+	}
+
+	if err := validateImageURL("icon url", c.IconURL); err != nil {
+		return err
+	}
+
+	if err := validateImageURL("cover url", c.CoverURL); err != nil {
+		return err
+	}
+
+	switch {
+	case c.Action != "":
+		if err := ValidateAction(c.Action); err != nil {
+			return err
+		}
+	case len(c.Actions) == 0:
+		return invalidMessageError("app card action required")
+	}
+
+	if len(c.Actions) > 0 {
+		return c.Actions.Validate()
+	}
+
+	return nil
+}
+
+// ActionInput sends text as a message when clicked
+func ActionInput(text string) string {
+	return actionInputPrefix + text
+}
+
+// ActionPay opens the legacy payment page
+func ActionPay(input *TransferInput) string {
+	return URL.Pay(input)
+}
+
+// ActionSafePay opens the safe payment page
+func ActionSafePay(input *TransferInput) string {
+	return URL.SafePay(input)
+}
+
+// ActionUser opens the profile of the user
+func ActionUser(userID string) string {
+	return URL.Users(userID)
+}
+
+// ActionApp opens the app with the action and params
+func ActionApp(appID, action string, params map[string]string) string {
+	return URL.Apps(appID, action, params)
+}
+
+// ActionSend shares the data of category
+func ActionSend(category SendSchemeCategory, data []byte, conversationID string) string {
+	return URL.Send(category, data, conversationID)
+}
+
+// NewAppButton returns a validated button
+func NewAppButton(label, action, color string) (AppButtonMessage, error) {
+	b := AppButtonMessage{
+		Label:  label,
+		Action: action,
+		Color:  color,
+	}
+
+	return b, b.Validate()
+}
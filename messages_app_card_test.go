@@ -0,0 +1,70 @@
+package mixin
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAction(t *testing.T) {
+	for _, action := range []string{
+		"input:hello",
+		"https://mixin.one",
+		ActionUser(newUUID()),
+		ActionApp(newUUID(), "", nil),
+		ActionSend(SendSchemeCategoryText, []byte("hi"), ""),
+		ActionSafePay(&TransferInput{AssetID: newUUID(), Amount: decimal.NewFromInt(1), OpponentID: newUUID()}),
+		ActionPay(&TransferInput{AssetID: newUUID(), Amount: decimal.NewFromInt(1), OpponentID: newUUID()}),
+	} {
+		assert.NoError(t, ValidateAction(action), action)
+	}
+
+	for _, action := range []string{"", "input:", "javascript:alert(1)", "ftp://mixin.one", "https://", "mixin://"} {
+		assert.ErrorIs(t, ValidateAction(action), ErrInvalidMessage, action)
+	}
+}
+
+func TestAppButtonValidate(t *testing.T) {
+	_, err := NewAppButton("ok", ActionInput("ok"), "#FF00aa")
+	assert.NoError(t, err)
+
+	_, err = NewAppButton("ok", ActionInput("ok"), "red")
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+
+	_, err = NewAppButton(string(make([]rune, maxAppButtonLabelLength+1)), ActionInput("ok"), "")
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+
+	buttons := make(AppButtonGroupMessage, maxAppButtons+1)
+	for i := range buttons {
+		buttons[i] = AppButtonMessage{Label: "b", Action: ActionInput("b")}
+	}
+	assert.ErrorIs(t, buttons.Validate(), ErrInvalidMessage)
+	assert.NoError(t, buttons[:maxAppButtons].Validate())
+
+	_, err = NewButtonGroupMessage(newUUID(), AppButtonGroupMessage{{Label: "b", Action: "javascript:void(0)"}})
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+}
+
+func TestAppCardValidate(t *testing.T) {
+	card := &AppCardMessage{
+		AppID:       newUUID(),
+		Title:       "title",
+		Description: "description",
+		IconURL:     "https://mixin.one/icon.png",
+		Action:      ActionApp(newUUID(), "", nil),
+	}
+	assert.NoError(t, card.Validate())
+
+	card.IconURL = "http://mixin.one/icon.png"
+	assert.ErrorIs(t, card.Validate(), ErrInvalidMessage)
+
+	card.IconURL = ""
+	card.Title = "a title longer than thirty six characters"
+	assert.ErrorIs(t, card.Validate(), ErrInvalidMessage)
+
+	card.Title = "title"
+	card.Action = ""
+	card.Actions = AppButtonGroupMessage{{Label: "open", Action: "https://mixin.one", Color: "#000000"}}
+	assert.NoError(t, card.Validate())
+}
@@ -0,0 +1,229 @@
+package mixin
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// SendAttachmentInput describes the media sent by SendImage, SendFile and SendVideo
+type SendAttachmentInput struct {
+	RecipientID string
+	// Reader is the content, uploads are retried only if it is an io.Seeker
+	Reader io.Reader
+	// Size of the content, -1 if unknown, then the content is buffered to a temporary file
+	Size     int64
+	MimeType string
+	// Name is the file name, required by SendFile
+	Name string
+	// Width and Height are required by SendImage
+	Width  int
+	Height int
+	// Duration of the video in milliseconds
+	Duration int
+	// Thumbnail is the thumbnail image, optional
+	Thumbnail []byte
+	// Encrypt encrypts the content and sends the key and digest in an ENCRYPTED_* message,
+	// it fails if the client or any session of the recipient doesn't support encrypted messages
+	Encrypt bool
+
+	UploadOptions  []UploadOption
+	MessageOptions []MessageOption
+}
+
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// uploadAttachmentInput creates an attachment and uploads the content of input to it
+func (c *Client) uploadAttachmentInput(ctx context.Context, input *SendAttachmentInput) (string, int, *AttachmentMessageEncrypt, error) {
+	attachment, err := c.CreateAttachment(ctx)
+	if err != nil {
+		return "", 0, nil, err
+	}
+
+	reader, contentSize := input.Reader, input.Size
+	if contentSize < 0 {
+		f, n, err := bufferAttachment(reader)
+		if err != nil {
+			return "", 0, nil, err
+		}
+
+		defer removeTempFile(f)
+		reader, contentSize = f, n
+	}
+
+	o := newUploadOptions(input.UploadOptions)
+	rewind, err := rewinder(reader)
+	if err != nil {
+		return "", 0, nil, err
+	}
+
+	var keys []byte
+	if input.Encrypt {
+		// keys & iv are fixed, so retries upload the same encrypted data
+		keys = make([]byte, attachmentKeysSize+aes.BlockSize)
+		if _, err := rand.Read(keys); err != nil {
+			return "", 0, nil, err
+		}
+	}
+
+	var (
+		counter   *countingReader
+		encryptor *AttachmentEncryptReader
+	)
+
+	if err := o.retry(ctx, rewind, func() error {
+		counter = &countingReader{Reader: reader}
+
+		var (
+			body io.Reader = counter
+			size           = contentSize
+		)
+
+		if input.Encrypt {
+			encryptor, err = newAttachmentEncryptReader(counter, keys[:attachmentKeysSize], keys[attachmentKeysSize:])
+			if err != nil {
+				return err
+			}
+
+			body = encryptor
+			size = EncryptedAttachmentSize(size)
+		}
+
+		return uploadAttachment(ctx, attachment.UploadURL, body, size, o.progress)
+	}); err != nil {
+		return "", 0, nil, err
+	}
+
+	var encrypt *AttachmentMessageEncrypt
+	if encryptor != nil {
+		// the digest is ready after reading to EOF
+		if _, err := io.Copy(io.Discard, encryptor); err != nil {
+			return "", 0, nil, err
+		}
+
+		encrypt = &AttachmentMessageEncrypt{
+			Key:    encryptor.Keys(),
+			Digest: encryptor.Digest(),
+		}
+	}
+
+	return attachment.AttachmentID, int(counter.n), encrypt, nil
+}
+
+type attachmentMessageBuilder func(attachmentID string, size int, encrypt *AttachmentMessageEncrypt) (*MessageRequest, error)
+
+// sendAttachment validates the message before uploading, so invalid inputs don't leave orphaned
+// attachments, then uploads the content and sends the message built by build. Messages of
+// encrypted attachments are sent as ENCRYPTED_* messages, the key is never sent plain.
+func (c *Client) sendAttachment(ctx context.Context, input *SendAttachmentInput, build attachmentMessageBuilder) (*MessageRequest, error) {
+	size := 1
+	if input.Size >= 0 {
+		size = int(input.Size)
+	}
+
+	if _, err := build(uuid.Nil.String(), size, nil); err != nil {
+		return nil, err
+	}
+
+	var cache *SessionCache
+	if input.Encrypt {
+		if _, ok := c.MessageLocker.(*messageLockNotSupported); ok {
+			return nil, errors.New("encrypted messages not supported by the client")
+		}
+
+		sessions, err := c.FetchSessions(ctx, []string{input.RecipientID})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(sessions) == 0 || !IsEncryptedMessageSupported(sessions) {
+			return nil, fmt.Errorf("sessions of %s don't support encrypted messages", input.RecipientID)
+		}
+
+		cache = NewSessionCache(0)
+		cache.Set(input.RecipientID, sessions)
+	}
+
+	attachmentID, n, encrypt, err := c.uploadAttachmentInput(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := build(attachmentID, n, encrypt)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Encrypt {
+		s := c.newE2ESender(cache)
+		s.requireEncrypted = true
+		return msg, s.send(ctx, []*MessageRequest{msg})
+	}
+
+	c.fillConversationID(msg)
+	return msg, c.SendMessage(ctx, msg)
+}
+
+// SendImage uploads the image and sends it as an image message
+func (c *Client) SendImage(ctx context.Context, input *SendAttachmentInput) (*MessageRequest, error) {
+	return c.sendAttachment(ctx, input, func(attachmentID string, size int, encrypt *AttachmentMessageEncrypt) (*MessageRequest, error) {
+		image := &ImageMessage{
+			AttachmentID:             attachmentID,
+			MimeType:                 input.MimeType,
+			Width:                    input.Width,
+			Height:                   input.Height,
+			Size:                     size,
+			AttachmentMessageEncrypt: encrypt,
+		}
+
+		if len(input.Thumbnail) > 0 {
+			image.Thumbnail = base64.StdEncoding.EncodeToString(input.Thumbnail)
+		}
+
+		return NewImageMessage(input.RecipientID, image, input.MessageOptions...)
+	})
+}
+
+// SendFile uploads the file and sends it as a data message
+func (c *Client) SendFile(ctx context.Context, input *SendAttachmentInput) (*MessageRequest, error) {
+	return c.sendAttachment(ctx, input, func(attachmentID string, size int, encrypt *AttachmentMessageEncrypt) (*MessageRequest, error) {
+		return NewDataMessage(input.RecipientID, &DataMessage{
+			AttachmentID:             attachmentID,
+			MimeType:                 input.MimeType,
+			Size:                     size,
+			Name:                     input.Name,
+			AttachmentMessageEncrypt: encrypt,
+		}, input.MessageOptions...)
+	})
+}
+
+// SendVideo uploads the video and sends it as a video message
+func (c *Client) SendVideo(ctx context.Context, input *SendAttachmentInput) (*MessageRequest, error) {
+	return c.sendAttachment(ctx, input, func(attachmentID string, size int, encrypt *AttachmentMessageEncrypt) (*MessageRequest, error) {
+		return NewVideoMessage(input.RecipientID, &VideoMessage{
+			AttachmentID:             attachmentID,
+			MimeType:                 input.MimeType,
+			Width:                    input.Width,
+			Height:                   input.Height,
+			Size:                     size,
+			Duration:                 input.Duration,
+			Thumbnail:                input.Thumbnail,
+			AttachmentMessageEncrypt: encrypt,
+		}, input.MessageOptions...)
+	})
+}
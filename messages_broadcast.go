@@ -0,0 +1,416 @@
+package mixin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// BroadcastRecipient is a user or a conversation (group) receiving the broadcast
+type BroadcastRecipient struct {
+	UserID         string `json:"user_id,omitempty"`
+	ConversationID string `json:"conversation_id,omitempty"`
+}
+
+func (r BroadcastRecipient) key() string {
+	if r.ConversationID != "" {
+		return "conversation:" + r.ConversationID
+	}
+
+	return "user:" + r.UserID
+}
+
+// BroadcastToUsers returns recipients sending to the contact conversations with the users
+func BroadcastToUsers(userIDs ...string) []BroadcastRecipient {
+	recipients := make([]BroadcastRecipient, len(userIDs))
+	for i, id := range userIDs {
+		recipients[i] = BroadcastRecipient{UserID: id}
+	}
+
+	return recipients
+}
+
+// BroadcastToConversations returns recipients sending to the conversations
+func BroadcastToConversations(conversationIDs ...string) []BroadcastRecipient {
+	recipients := make([]BroadcastRecipient, len(conversationIDs))
+	for i, id := range conversationIDs {
+		recipients[i] = BroadcastRecipient{ConversationID: id}
+	}
+
+	return recipients
+}
+
+type BroadcastFailure struct {
+	Recipient BroadcastRecipient `json:"recipient"`
+	MessageID string             `json:"message_id"`
+	// Code is the mixin error code, 0 for other errors
+	Code  int    `json:"code"`
+	Error string `json:"error"`
+}
+
+// BroadcastCheckpoint is the progress of a broadcast, Offset is the index of
+// the next recipient to send. RecipientsHash identifies the recipients list,
+// a broadcast can't be resumed with other recipients.
+type BroadcastCheckpoint struct {
+	BroadcastID    string             `json:"broadcast_id"`
+	RecipientsHash string             `json:"recipients_hash,omitempty"`
+	Offset         int                `json:"offset"`
+	Sent           int                `json:"sent"`
+	Failures       []BroadcastFailure `json:"failures,omitempty"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+}
+
+// BroadcastCheckpointStore persists the checkpoints so interrupted broadcasts could be resumed
+type BroadcastCheckpointStore interface {
+	// ReadBroadcastCheckpoint returns nil if not found
+	ReadBroadcastCheckpoint(ctx context.Context, broadcastID string) (*BroadcastCheckpoint, error)
+	SaveBroadcastCheckpoint(ctx context.Context, checkpoint *BroadcastCheckpoint) error
+}
+
+type BroadcastInput struct {
+	// BroadcastID identifies the broadcast, the message id for every recipient
+	// is derived from it, so resending the broadcast won't duplicate messages
+	BroadcastID string
+	Recipients  []BroadcastRecipient
+	// Template provides Category, Data (or DataBase64), RepresentativeID and Silent
+	Template *MessageRequest
+	// BatchSize is the number of messages per request, default and max is 100
+	BatchSize int
+	// Rate is the max messages sent per second, default is 100
+	Rate int
+	// Retries of a batch failed by transient errors, default is 5
+	Retries int
+	// OnProgress is called after every batch
+	OnProgress func(checkpoint *BroadcastCheckpoint, total int)
+}
+
+type BroadcastReport struct {
+	BroadcastID string
+	Total       int
+	Sent        int
+	Failed      int
+	// FailuresByCode groups the failures by mixin error code, 0 for other errors
+	FailuresByCode map[int][]BroadcastFailure
+}
+
+// Broadcaster sends a message to a large number of recipients
+type Broadcaster struct {
+	client *Client
+	store  BroadcastCheckpointStore
+
+	// send sends one batch, client.SendMessages unless stubbed
+	send func(ctx context.Context, messages []*MessageRequest) error
+}
+
+// NewBroadcaster returns a Broadcaster, checkpoints are kept in memory if store is nil
+func NewBroadcaster(client *Client, store BroadcastCheckpointStore) *Broadcaster {
+	if store == nil {
+		store = NewMemoryBroadcastCheckpointStore()
+	}
+
+	return &Broadcaster{
+		client: client,
+		store:  store,
+		send:   client.SendMessages,
+	}
+}
+
+// BroadcastMessageID returns the message id of the broadcast for the recipient
+func BroadcastMessageID(broadcastID string, recipient BroadcastRecipient) string {
+	return uuidHash([]byte(broadcastID + ":" + recipient.key()))
+}
+
+// broadcastRecipientsHash hashes the keys of the recipients in order
+func broadcastRecipientsHash(recipients []BroadcastRecipient) string {
+	h := sha256.New()
+	for _, r := range recipients {
+		h.Write([]byte(r.key()))
+		h.Write([]byte{'\n'})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (b *Broadcaster) message(input *BroadcastInput, recipient BroadcastRecipient) *MessageRequest {
+	msg := &MessageRequest{
+		ConversationID:   recipient.ConversationID,
+		RecipientID:      recipient.UserID,
+		MessageID:        BroadcastMessageID(input.BroadcastID, recipient),
+		Category:         input.Template.Category,
+		Data:             input.Template.Data,
+		DataBase64:       input.Template.DataBase64,
+		RepresentativeID: input.Template.RepresentativeID,
+		Silent:           input.Template.Silent,
+	}
+
+	if b.client != nil {
+		b.client.fillConversationID(msg)
+	}
+
+	return msg
+}
+
+// Broadcast sends the template to all recipients, it resumes from the checkpoint
+// of the broadcast if any. Failures of single messages are collected in the report,
+// the error is returned only if the broadcast is interrupted.
+func (b *Broadcaster) Broadcast(ctx context.Context, input BroadcastInput) (*BroadcastReport, error) {
+	if input.BroadcastID == "" || input.Template == nil {
+		return nil, invalidMessageError("broadcast id and template required")
+	}
+
+	if input.BatchSize <= 0 || input.BatchSize > maxMessagesPerRequest {
+		input.BatchSize = maxMessagesPerRequest
+	}
+
+	if input.Rate <= 0 {
+		input.Rate = 100
+	}
+
+	if input.Retries <= 0 {
+		input.Retries = 5
+	}
+
+	checkpoint, err := b.store.ReadBroadcastCheckpoint(ctx, input.BroadcastID)
+	if err != nil {
+		return nil, err
+	}
+
+	recipientsHash := broadcastRecipientsHash(input.Recipients)
+	if checkpoint == nil {
+		checkpoint = &BroadcastCheckpoint{BroadcastID: input.BroadcastID, RecipientsHash: recipientsHash}
+	} else if checkpoint.RecipientsHash != recipientsHash {
+		return nil, fmt.Errorf("broadcast %s: recipients changed since the checkpoint", input.BroadcastID)
+	}
+
+	interval := time.Duration(input.BatchSize) * time.Second / time.Duration(input.Rate)
+
+	for checkpoint.Offset < len(input.Recipients) {
+		start := time.Now()
+
+		end := checkpoint.Offset + input.BatchSize
+		if end > len(input.Recipients) {
+			end = len(input.Recipients)
+		}
+
+		recipients := input.Recipients[checkpoint.Offset:end]
+		messages := make([]*MessageRequest, len(recipients))
+		for i, r := range recipients {
+			messages[i] = b.message(&input, r)
+		}
+
+		if err := b.sendBatch(ctx, &input, checkpoint, recipients, messages); err != nil {
+			return nil, err
+		}
+
+		checkpoint.Offset = end
+		checkpoint.UpdatedAt = time.Now()
+		if err := b.store.SaveBroadcastCheckpoint(ctx, checkpoint); err != nil {
+			return nil, err
+		}
+
+		if input.OnProgress != nil {
+			input.OnProgress(checkpoint, len(input.Recipients))
+		}
+
+		if checkpoint.Offset < len(input.Recipients) {
+			if err := sleepContext(ctx, interval-time.Since(start)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	report := &BroadcastReport{
+		BroadcastID:    input.BroadcastID,
+		Total:          len(input.Recipients),
+		Sent:           checkpoint.Sent,
+		Failed:         len(checkpoint.Failures),
+		FailuresByCode: make(map[int][]BroadcastFailure),
+	}
+
+	for _, f := range checkpoint.Failures {
+		report.FailuresByCode[f.Code] = append(report.FailuresByCode[f.Code], f)
+	}
+
+	return report, nil
+}
+
+func (b *Broadcaster) sendBatch(ctx context.Context, input *BroadcastInput, checkpoint *BroadcastCheckpoint, recipients []BroadcastRecipient, messages []*MessageRequest) error {
+	send := func(ctx context.Context, messages []*MessageRequest) error {
+		return b.sendWithRetry(ctx, input, messages)
+	}
+
+	err := send(ctx, messages)
+	if err == nil {
+		checkpoint.Sent += len(messages)
+		return nil
+	}
+
+	if IsTransientError(err) || ctx.Err() != nil {
+		return err
+	}
+
+	index := make(map[string]BroadcastRecipient, len(messages))
+	for i, msg := range messages {
+		index[msg.MessageID] = recipients[i]
+	}
+
+	done := func(msg *MessageRequest, err error) error {
+		if err == nil {
+			checkpoint.Sent++
+			return nil
+		}
+
+		failure := BroadcastFailure{
+			Recipient: index[msg.MessageID],
+			MessageID: msg.MessageID,
+			Error:     err.Error(),
+		}
+
+		var e *Error
+		if errors.As(err, &e) {
+			failure.Code = e.Code
+		}
+
+		checkpoint.Failures = append(checkpoint.Failures, failure)
+		return nil
+	}
+
+	if len(messages) == 1 {
+		return done(messages[0], err)
+	}
+
+	_, err = sendMessagesOneByOne(ctx, messages, time.Second/time.Duration(input.Rate), send, done)
+	return err
+}
+
+func (b *Broadcaster) sendWithRetry(ctx context.Context, input *BroadcastInput, messages []*MessageRequest) error {
+	backoff := time.Second
+	for i := 0; ; i++ {
+		err := b.send(ctx, messages)
+		if !IsTransientError(err) || i >= input.Retries {
+			return err
+		}
+
+		if err := sleepContext(ctx, backoff); err != nil {
+			return err
+		}
+
+		if backoff *= 2; backoff > time.Minute {
+			backoff = time.Minute
+		}
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type memoryBroadcastCheckpointStore struct {
+	checkpoints map[string][]byte
+	mux         sync.Mutex
+}
+
+// NewMemoryBroadcastCheckpointStore returns a BroadcastCheckpointStore living in memory
+func NewMemoryBroadcastCheckpointStore() BroadcastCheckpointStore {
+	return &memoryBroadcastCheckpointStore{
+		checkpoints: make(map[string][]byte),
+	}
+}
+
+func (s *memoryBroadcastCheckpointStore) ReadBroadcastCheckpoint(_ context.Context, broadcastID string) (*BroadcastCheckpoint, error) {
+	s.mux.Lock()
+	b, ok := s.checkpoints[broadcastID]
+	s.mux.Unlock()
+
+	if !ok {
+		return nil, nil
+	}
+
+	var checkpoint BroadcastCheckpoint
+	if err := json.Unmarshal(b, &checkpoint); err != nil {
+		return nil, err
+	}
+
+	return &checkpoint, nil
+}
+
+func (s *memoryBroadcastCheckpointStore) SaveBroadcastCheckpoint(_ context.Context, checkpoint *BroadcastCheckpoint) error {
+	b, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	s.checkpoints[checkpoint.BroadcastID] = b
+	s.mux.Unlock()
+	return nil
+}
+
+type fileBroadcastCheckpointStore struct {
+	dir string
+}
+
+// NewFileBroadcastCheckpointStore returns a BroadcastCheckpointStore saving every checkpoint as a json file in dir
+func NewFileBroadcastCheckpointStore(dir string) (BroadcastCheckpointStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &fileBroadcastCheckpointStore{dir: dir}, nil
+}
+
+func (s *fileBroadcastCheckpointStore) path(broadcastID string) string {
+	return filepath.Join(s.dir, uuidHash([]byte(broadcastID))+".json")
+}
+
+func (s *fileBroadcastCheckpointStore) ReadBroadcastCheckpoint(_ context.Context, broadcastID string) (*BroadcastCheckpoint, error) {
+	b, err := os.ReadFile(s.path(broadcastID))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var checkpoint BroadcastCheckpoint
+	if err := json.Unmarshal(b, &checkpoint); err != nil {
+		return nil, err
+	}
+
+	return &checkpoint, nil
+}
+
+func (s *fileBroadcastCheckpointStore) SaveBroadcastCheckpoint(_ context.Context, checkpoint *BroadcastCheckpoint) error {
+	b, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	path := s.path(checkpoint.BroadcastID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,119 @@
+package mixin
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroadcaster(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store, err := NewFileBroadcastCheckpointStore(t.TempDir())
+	require.NoError(t, err)
+
+	userIDs := make([]string, 7)
+	for i := range userIDs {
+		userIDs[i] = newUUID()
+	}
+	blocked := userIDs[4]
+
+	recipients := append(BroadcastToUsers(userIDs...), BroadcastToConversations(newUUID())...)
+	template, err := NewTextMessage(newUUID(), "announcement")
+	require.NoError(t, err)
+
+	input := BroadcastInput{
+		BroadcastID: newUUID(),
+		Recipients:  recipients,
+		Template:    template,
+		BatchSize:   3,
+		Rate:        1000,
+		Retries:     1,
+	}
+
+	sent := map[string]int{}
+	b := NewBroadcaster(&Client{}, store)
+	b.send = func(_ context.Context, messages []*MessageRequest) error {
+		for _, msg := range messages {
+			if msg.RecipientID == blocked {
+				return createError(202, 403, "forbidden")
+			}
+		}
+
+		if len(sent) >= 3 {
+			cancel()
+			return ctx.Err()
+		}
+
+		for _, msg := range messages {
+			sent[msg.MessageID]++
+		}
+
+		return nil
+	}
+
+	// interrupted after the first batch
+	_, err = b.Broadcast(ctx, input)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	ctx = context.Background()
+	checkpoint, err := store.ReadBroadcastCheckpoint(ctx, input.BroadcastID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, checkpoint.Offset)
+
+	b.send = func(_ context.Context, messages []*MessageRequest) error {
+		for _, msg := range messages {
+			if msg.RecipientID == blocked {
+				return createError(202, 403, "forbidden")
+			}
+		}
+
+		for _, msg := range messages {
+			sent[msg.MessageID]++
+		}
+
+		return nil
+	}
+
+	report, err := b.Broadcast(ctx, input)
+	require.NoError(t, err)
+	assert.Equal(t, 8, report.Total)
+	assert.Equal(t, 7, report.Sent)
+	assert.Equal(t, 1, report.Failed)
+	if assert.Len(t, report.FailuresByCode[403], 1) {
+		assert.Equal(t, blocked, report.FailuresByCode[403][0].Recipient.UserID)
+	}
+
+	assert.Len(t, sent, 7)
+	for _, n := range sent {
+		assert.Equal(t, 1, n, "sent once")
+	}
+
+	assert.Equal(t, BroadcastMessageID(input.BroadcastID, recipients[0]), BroadcastMessageID(input.BroadcastID, BroadcastRecipient{UserID: userIDs[0]}))
+
+	t.Run("recipients changed", func(t *testing.T) {
+		changed := input
+		changed.Recipients = recipients[1:]
+		_, err := b.Broadcast(ctx, changed)
+		assert.Error(t, err)
+	})
+
+	t.Run("one by one is rate limited", func(t *testing.T) {
+		limited := input
+		limited.BroadcastID = newUUID()
+		limited.Recipients = BroadcastToUsers(userIDs[3], blocked, userIDs[5])
+		limited.Rate = 20
+
+		start := time.Now()
+		report, err := b.Broadcast(ctx, limited)
+		require.NoError(t, err)
+		assert.Equal(t, 2, report.Sent)
+		assert.Equal(t, 1, report.Failed)
+		assert.GreaterOrEqual(t, time.Since(start), 2*time.Second/20, "3 messages sent at 20 per second")
+	})
+}
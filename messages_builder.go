@@ -0,0 +1,270 @@
+package mixin
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+var ErrInvalidMessage = errors.New("invalid message")
+
+func invalidMessageError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidMessage, fmt.Sprintf(format, args...))
+}
+
+type messageOptions struct {
+	conversationID   string
+	senderID         string
+	key              string
+	representativeID string
+	quoteMessageID   string
+	mentions         []string
+	silent           bool
+}
+
+// MessageOption customizes a MessageRequest built by the New*Message builders
+type MessageOption func(opts *messageOptions)
+
+// WithConversation sends the message to the conversation, a group for example,
+// otherwise it is sent to the contact conversation with the recipient
+func WithConversation(conversationID string) MessageOption {
+	return func(opts *messageOptions) {
+		opts.conversationID = conversationID
+	}
+}
+
+// WithSender derives the contact conversation id between the sender and the recipient,
+// otherwise Client.SendMessage uses the contact conversation between the client and the recipient
+func WithSender(senderID string) MessageOption {
+	return func(opts *messageOptions) {
+		opts.senderID = senderID
+	}
+}
+
+// WithMessageKey derives the message id from the business key and the conversation, so
+// sending the same message twice with the same key is idempotent. WithSender or
+// WithConversation is required, otherwise different senders would share the message ids.
+func WithMessageKey(key string) MessageOption {
+	return func(opts *messageOptions) {
+		opts.key = key
+	}
+}
+
+func WithRepresentative(userID string) MessageOption {
+	return func(opts *messageOptions) {
+		opts.representativeID = userID
+	}
+}
+
+// WithQuote quotes the message
+func WithQuote(messageID string) MessageOption {
+	return func(opts *messageOptions) {
+		opts.quoteMessageID = messageID
+	}
+}
+
+// WithMentions mentions the users by identity number in text and post messages,
+// the mentions missing from the content are prepended to it
+func WithMentions(identityNumbers ...string) MessageOption {
+	return func(opts *messageOptions) {
+		opts.mentions = append(opts.mentions, identityNumbers...)
+	}
+}
+
+// WithSilent sends the message without notification
+func WithSilent() MessageOption {
+	return func(opts *messageOptions) {
+		opts.silent = true
+	}
+}
+
+func newMessageRequest(recipientID, category string, data []byte, opts []MessageOption) (*MessageRequest, error) {
+	if _, err := uuid.FromString(recipientID); err != nil {
+		return nil, invalidMessageError("invalid recipient id %q", recipientID)
+	}
+
+	var o messageOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if len(o.mentions) > 0 && isTextMessageCategory(category) {
+		data = []byte(addMentions(string(data), o.mentions))
+	}
+
+	if o.quoteMessageID != "" {
+		if _, err := uuid.FromString(o.quoteMessageID); err != nil {
+			return nil, invalidMessageError("invalid quote message id %q", o.quoteMessageID)
+		}
+	}
+
+	msg := &MessageRequest{
+		ConversationID:   o.conversationID,
+		RecipientID:      recipientID,
+		Category:         category,
+		Data:             base64.StdEncoding.EncodeToString(data),
+		RepresentativeID: o.representativeID,
+		QuoteMessageID:   o.quoteMessageID,
+		Silent:           o.silent,
+	}
+
+	if msg.ConversationID == "" && o.senderID != "" {
+		msg.ConversationID = UniqueConversationID(o.senderID, recipientID)
+	}
+
+	if o.key != "" {
+		if msg.ConversationID == "" {
+			return nil, invalidMessageError("message key %q requires the sender or the conversation", o.key)
+		}
+
+		msg.MessageID = uuidHash([]byte(fmt.Sprintf("%s:%s:%s", msg.ConversationID, recipientID, o.key)))
+	} else {
+		msg.MessageID = newUUID()
+	}
+
+	return msg, nil
+}
+
+func newJSONMessageRequest(recipientID, category string, payload interface{}, opts []MessageOption) (*MessageRequest, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMessageRequest(recipientID, category, data, opts)
+}
+
+func NewTextMessage(recipientID, text string, opts ...MessageOption) (*MessageRequest, error) {
+	if text == "" {
+		return nil, invalidMessageError("empty text")
+	}
+
+	return newMessageRequest(recipientID, MessageCategoryPlainText, []byte(text), opts)
+}
+
+// NewPostMessage builds a markdown message
+func NewPostMessage(recipientID, markdown string, opts ...MessageOption) (*MessageRequest, error) {
+	if markdown == "" {
+		return nil, invalidMessageError("empty post")
+	}
+
+	return newMessageRequest(recipientID, MessageCategoryPlainPost, []byte(markdown), opts)
+}
+
+func validateAttachment(attachmentID, mimeType string, size int) error {
+	if attachmentID == "" {
+		return invalidMessageError("empty attachment id")
+	}
+
+	if mimeType == "" {
+		return invalidMessageError("empty mime type")
+	}
+
+	if size <= 0 {
+		return invalidMessageError("invalid attachment size %d", size)
+	}
+
+	return nil
+}
+
+func NewImageMessage(recipientID string, image *ImageMessage, opts ...MessageOption) (*MessageRequest, error) {
+	if err := validateAttachment(image.AttachmentID, image.MimeType, image.Size); err != nil {
+		return nil, err
+	}
+
+	if image.Width <= 0 || image.Height <= 0 {
+		return nil, invalidMessageError("invalid image size %dx%d", image.Width, image.Height)
+	}
+
+	return newJSONMessageRequest(recipientID, MessageCategoryPlainImage, image, opts)
+}
+
+func NewDataMessage(recipientID string, file *DataMessage, opts ...MessageOption) (*MessageRequest, error) {
+	if err := validateAttachment(file.AttachmentID, file.MimeType, file.Size); err != nil {
+		return nil, err
+	}
+
+	if file.Name == "" {
+		return nil, invalidMessageError("empty file name")
+	}
+
+	return newJSONMessageRequest(recipientID, MessageCategoryPlainData, file, opts)
+}
+
+func NewAudioMessage(recipientID string, audio *AudioMessage, opts ...MessageOption) (*MessageRequest, error) {
+	if err := validateAttachment(audio.AttachmentID, audio.MimeType, audio.Size); err != nil {
+		return nil, err
+	}
+
+	return newJSONMessageRequest(recipientID, MessageCategoryPlainAudio, audio, opts)
+}
+
+func NewVideoMessage(recipientID string, video *VideoMessage, opts ...MessageOption) (*MessageRequest, error) {
+	if err := validateAttachment(video.AttachmentID, video.MimeType, video.Size); err != nil {
+		return nil, err
+	}
+
+	return newJSONMessageRequest(recipientID, MessageCategoryPlainVideo, video, opts)
+}
+
+func NewStickerMessage(recipientID string, sticker *StickerMessage, opts ...MessageOption) (*MessageRequest, error) {
+	if sticker.StickerID == "" && (sticker.AlbumID == "" || sticker.Name == "") {
+		return nil, invalidMessageError("sticker id or album id with name required")
+	}
+
+	return newJSONMessageRequest(recipientID, MessageCategoryPlainSticker, sticker, opts)
+}
+
+// NewContactMessage shares the user as a contact card
+func NewContactMessage(recipientID, userID string, opts ...MessageOption) (*MessageRequest, error) {
+	if _, err := uuid.FromString(userID); err != nil {
+		return nil, invalidMessageError("invalid contact user id %q", userID)
+	}
+
+	return newJSONMessageRequest(recipientID, MessageCategoryPlainContact, ContactMessage{UserID: userID}, opts)
+}
+
+func NewLocationMessage(recipientID string, location *LocationMessage, opts ...MessageOption) (*MessageRequest, error) {
+	if math.Abs(location.Latitude) > 90 || math.Abs(location.Longitude) > 180 {
+		return nil, invalidMessageError("invalid location %v,%v", location.Latitude, location.Longitude)
+	}
+
+	return newJSONMessageRequest(recipientID, MessageCategoryPlainLocation, location, opts)
+}
+
+func NewLiveMessage(recipientID string, live *LiveMessage, opts ...MessageOption) (*MessageRequest, error) {
+	if live.URL == "" || live.ThumbUrl == "" {
+		return nil, invalidMessageError("live url and thumb url required")
+	}
+
+	return newJSONMessageRequest(recipientID, MessageCategoryPlainLive, live, opts)
+}
+
+func NewAppCardMessage(recipientID string, card *AppCardMessage, opts ...MessageOption) (*MessageRequest, error) {
+	if err := card.Validate(); err != nil {
+		return nil, err
+	}
+
+	return newJSONMessageRequest(recipientID, MessageCategoryAppCard, card, opts)
+}
+
+func NewButtonGroupMessage(recipientID string, buttons AppButtonGroupMessage, opts ...MessageOption) (*MessageRequest, error) {
+	if err := buttons.Validate(); err != nil {
+		return nil, err
+	}
+
+	return newJSONMessageRequest(recipientID, MessageCategoryAppButtonGroup, buttons, opts)
+}
+
+// NewRecallMessage recalls the message sent by the bot before
+func NewRecallMessage(recipientID, messageID string, opts ...MessageOption) (*MessageRequest, error) {
+	if _, err := uuid.FromString(messageID); err != nil {
+		return nil, invalidMessageError("invalid recall message id %q", messageID)
+	}
+
+	return newJSONMessageRequest(recipientID, MessageCategoryMessageRecall, RecallMessage{MessageID: messageID}, opts)
+}
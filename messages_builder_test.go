@@ -0,0 +1,119 @@
+package mixin
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTextMessage(t *testing.T) {
+	botID, recipientID := newUUID(), newUUID()
+
+	msg, err := NewTextMessage(recipientID, "hello", WithSender(botID), WithMessageKey("order:1"))
+	require.NoError(t, err)
+	assert.Equal(t, MessageCategoryPlainText, msg.Category)
+	assert.Equal(t, UniqueConversationID(botID, recipientID), msg.ConversationID)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("hello")), msg.Data)
+
+	again, err := NewTextMessage(recipientID, "hello again", WithSender(botID), WithMessageKey("order:1"))
+	require.NoError(t, err)
+	assert.Equal(t, msg.MessageID, again.MessageID, "same key, same message id")
+
+	other, err := NewTextMessage(recipientID, "hello", WithSender(botID))
+	require.NoError(t, err)
+	assert.NotEqual(t, msg.MessageID, other.MessageID)
+
+	_, err = NewTextMessage(recipientID, "hello", WithMessageKey("order:1"))
+	assert.True(t, errors.Is(err, ErrInvalidMessage), "message key without sender or conversation")
+
+	_, err = NewTextMessage(recipientID, "")
+	assert.True(t, errors.Is(err, ErrInvalidMessage))
+
+	_, err = NewTextMessage("not an uuid", "hello")
+	assert.True(t, errors.Is(err, ErrInvalidMessage))
+}
+
+func TestSendMessageWithoutConversation(t *testing.T) {
+	var sent []*MessageRequest
+	newTestAPIServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var raw json.RawMessage
+		_ = json.NewDecoder(r.Body).Decode(&raw)
+
+		var req []*MessageRequest
+		if json.Unmarshal(raw, &req) != nil {
+			req = []*MessageRequest{{}}
+			_ = json.Unmarshal(raw, req[0])
+		}
+		sent = append(sent, req...)
+		writeTestAPIData(w, struct{}{})
+	}))
+
+	c := NewFromAccessToken("token")
+	c.ClientID = newUUID()
+
+	recipientID := newUUID()
+	msg, err := NewTextMessage(recipientID, "hello")
+	require.NoError(t, err)
+
+	require.NoError(t, c.SendMessage(context.Background(), msg))
+	require.NoError(t, c.SendMessages(context.Background(), []*MessageRequest{msg}))
+	require.Len(t, sent, 2)
+	for _, req := range sent {
+		assert.Equal(t, UniqueConversationID(c.ClientID, recipientID), req.ConversationID)
+	}
+	assert.Empty(t, msg.ConversationID, "the message itself is not modified")
+}
+
+func TestNewAppCardMessage(t *testing.T) {
+	recipientID := newUUID()
+	card := &AppCardMessage{
+		AppID:       newUUID(),
+		Title:       "title",
+		Description: "description",
+		Action:      "https://mixin.one",
+	}
+
+	msg, err := NewAppCardMessage(recipientID, card, WithConversation(newUUID()), WithSilent())
+	require.NoError(t, err)
+	assert.Equal(t, MessageCategoryAppCard, msg.Category)
+	assert.True(t, msg.Silent)
+
+	data, err := base64.StdEncoding.DecodeString(msg.Data)
+	require.NoError(t, err)
+
+	var decoded AppCardMessage
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, card.AppID, decoded.AppID)
+
+	card.Action = ""
+	_, err = NewAppCardMessage(recipientID, card)
+	assert.True(t, errors.Is(err, ErrInvalidMessage))
+}
+
+func TestNewMessageValidation(t *testing.T) {
+	recipientID := newUUID()
+
+	_, err := NewButtonGroupMessage(recipientID, AppButtonGroupMessage{{Label: "ok"}})
+	assert.True(t, errors.Is(err, ErrInvalidMessage), "button action required")
+
+	_, err = NewContactMessage(recipientID, "")
+	assert.True(t, errors.Is(err, ErrInvalidMessage))
+
+	_, err = NewLocationMessage(recipientID, &LocationMessage{Latitude: 91})
+	assert.True(t, errors.Is(err, ErrInvalidMessage))
+
+	_, err = NewStickerMessage(recipientID, &StickerMessage{Name: "hi"})
+	assert.True(t, errors.Is(err, ErrInvalidMessage))
+
+	_, err = NewImageMessage(recipientID, &ImageMessage{AttachmentID: newUUID(), MimeType: "image/png", Size: 10})
+	assert.True(t, errors.Is(err, ErrInvalidMessage), "image width & height required")
+
+	_, err = NewStickerMessage(recipientID, &StickerMessage{StickerID: newUUID()})
+	assert.NoError(t, err)
+}
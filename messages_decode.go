@@ -0,0 +1,98 @@
+package mixin
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// RawData returns the decoded data of the message, DataBase64 is preferred if set
+func (m *MessageView) RawData() ([]byte, error) {
+	if m.DataBase64 != "" {
+		return base64.RawURLEncoding.DecodeString(m.DataBase64)
+	}
+
+	return base64.StdEncoding.DecodeString(m.Data)
+}
+
+// Decode returns the typed payload of the message according to its category:
+//
+//	PLAIN_TEXT, PLAIN_POST   string
+//	PLAIN_IMAGE              *ImageMessage
+//	PLAIN_DATA               *DataMessage
+//	PLAIN_AUDIO              *AudioMessage
+//	PLAIN_VIDEO              *VideoMessage
+//	PLAIN_STICKER            *StickerMessage
+//	PLAIN_CONTACT            *ContactMessage
+//	PLAIN_LOCATION           *LocationMessage
+//	PLAIN_LIVE               *LiveMessage
+//	PLAIN_TRANSCRIPT         []TranscriptMessage
+//	APP_CARD                 *AppCardMessage
+//	APP_BUTTON_GROUP         AppButtonGroupMessage
+//	MESSAGE_RECALL           *RecallMessage
+//	SYSTEM_CONVERSATION      *SystemConversationPayload
+//	SYSTEM_ACCOUNT_SNAPSHOT  *Snapshot
+//	SYSTEM_SAFE_SNAPSHOT     *SafeSnapshot
+//
+// the raw data is returned as []byte for other categories
+func (m *MessageView) Decode() (interface{}, error) {
+	data, err := m.RawData()
+	if err != nil {
+		return nil, err
+	}
+
+	var payload interface{}
+
+	switch m.Category {
+	case MessageCategoryPlainText, MessageCategoryPlainPost:
+		return string(data), nil
+	case MessageCategoryPlainImage:
+		payload = &ImageMessage{}
+	case MessageCategoryPlainData:
+		payload = &DataMessage{}
+	case MessageCategoryPlainAudio:
+		payload = &AudioMessage{}
+	case MessageCategoryPlainVideo:
+		payload = &VideoMessage{}
+	case MessageCategoryPlainSticker:
+		payload = &StickerMessage{}
+	case MessageCategoryPlainContact:
+		payload = &ContactMessage{}
+	case MessageCategoryPlainLocation:
+		payload = &LocationMessage{}
+	case MessageCategoryPlainLive:
+		payload = &LiveMessage{}
+	case MessageCategoryPlainTranscript:
+		var transcripts []TranscriptMessage
+		if err := json.Unmarshal(data, &transcripts); err != nil {
+			return nil, fmt.Errorf("decode %s: %w", m.Category, err)
+		}
+
+		return transcripts, nil
+	case MessageCategoryAppCard:
+		payload = &AppCardMessage{}
+	case MessageCategoryAppButtonGroup:
+		var buttons AppButtonGroupMessage
+		if err := json.Unmarshal(data, &buttons); err != nil {
+			return nil, fmt.Errorf("decode %s: %w", m.Category, err)
+		}
+
+		return buttons, nil
+	case MessageCategoryMessageRecall:
+		payload = &RecallMessage{}
+	case MessageCategorySystemConversation:
+		payload = &SystemConversationPayload{}
+	case MessageCategorySystemAccountSnapshot:
+		payload = &Snapshot{}
+	case MessageCategorySystemSafeSnapshot:
+		payload = &SafeSnapshot{}
+	default:
+		return data, nil
+	}
+
+	if err := json.Unmarshal(data, payload); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", m.Category, err)
+	}
+
+	return payload, nil
+}
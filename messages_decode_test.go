@@ -0,0 +1,55 @@
+package mixin
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageViewDecode(t *testing.T) {
+	view := func(category, data string) *MessageView {
+		return &MessageView{
+			Category: category,
+			Data:     base64.StdEncoding.EncodeToString([]byte(data)),
+		}
+	}
+
+	payload, err := view(MessageCategoryPlainText, "hello").Decode()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", payload)
+
+	payload, err = view(MessageCategoryPlainImage, `{"attachment_id":"a","width":10}`).Decode()
+	require.NoError(t, err)
+	if image, ok := payload.(*ImageMessage); assert.True(t, ok) {
+		assert.Equal(t, "a", image.AttachmentID)
+		assert.Equal(t, 10, image.Width)
+	}
+
+	payload, err = view(MessageCategoryPlainTranscript, `[{"message_id":"m"}]`).Decode()
+	require.NoError(t, err)
+	if transcripts, ok := payload.([]TranscriptMessage); assert.True(t, ok) {
+		assert.Len(t, transcripts, 1)
+	}
+
+	payload, err = view(MessageCategoryAppButtonGroup, `[{"label":"ok","action":"input:ok"}]`).Decode()
+	require.NoError(t, err)
+	assert.IsType(t, AppButtonGroupMessage{}, payload)
+
+	payload, err = view(MessageCategorySystemSafeSnapshot, `{"snapshot_id":"s"}`).Decode()
+	require.NoError(t, err)
+	assert.IsType(t, &SafeSnapshot{}, payload)
+
+	payload, err = view("UNKNOWN", "raw").Decode()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("raw"), payload)
+
+	_, err = view(MessageCategoryPlainImage, "not json").Decode()
+	assert.Error(t, err)
+
+	m := &MessageView{Category: MessageCategoryPlainText, DataBase64: base64.RawURLEncoding.EncodeToString([]byte("hi"))}
+	payload, err = m.Decode()
+	require.NoError(t, err)
+	assert.Equal(t, "hi", payload)
+}
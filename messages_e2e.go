@@ -0,0 +1,164 @@
+package mixin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// maxEncryptedMessageRetries limits resending messages failed by stale sessions
+const maxEncryptedMessageRetries = 3
+
+// canEncryptMessage reports whether the message could be encrypted, messages
+// without recipient (sent to groups) and non-plain categories are sent plain
+func canEncryptMessage(msg *MessageRequest) bool {
+	return msg.RecipientID != "" && IsPlainMessageCategory(msg.Category)
+}
+
+// SendMessagesE2E sends messages encrypted if all sessions of the recipient support it,
+// otherwise plain. The sessions are cached in cache, a new cache is used if it is nil,
+// stale sessions reported by the FAILED receipts are refreshed and only the affected
+// messages are sent again. The messages are sent in batches of maxMessagesPerRequest
+// and not modified apart from filling the conversation id.
+func (c *Client) SendMessagesE2E(ctx context.Context, cache *SessionCache, messages []*MessageRequest) error {
+	return c.newE2ESender(cache).send(ctx, messages)
+}
+
+type e2eSender struct {
+	client *Client
+	cache  *SessionCache
+	// requireEncrypted fails messages that can't be encrypted instead of sending them plain
+	requireEncrypted bool
+
+	// sendEncrypted and sendPlain default to SendEncryptedMessages and SendMessages of the client
+	sendEncrypted func(ctx context.Context, messages []*MessageRequest) ([]*EncryptedMessageReceipt, error)
+	sendPlain     func(ctx context.Context, messages []*MessageRequest) error
+}
+
+func (c *Client) newE2ESender(cache *SessionCache) *e2eSender {
+	if cache == nil {
+		cache = NewSessionCache(0)
+	}
+
+	return &e2eSender{
+		client:        c,
+		cache:         cache,
+		sendEncrypted: c.SendEncryptedMessages,
+		sendPlain:     c.SendMessages,
+	}
+}
+
+func (s *e2eSender) send(ctx context.Context, messages []*MessageRequest) error {
+	var (
+		plain   []*MessageRequest
+		pending []*MessageRequest
+	)
+
+	for _, msg := range messages {
+		s.client.fillConversationID(msg)
+		if canEncryptMessage(msg) {
+			pending = append(pending, msg)
+		} else {
+			plain = append(plain, msg)
+		}
+	}
+
+	fallback, err := s.sendEncryptedWithRetry(ctx, pending)
+	plain = append(plain, fallback...)
+
+	// the plain messages are sent even if some encrypted messages failed
+	for batch := range slices.Chunk(plain, maxMessagesPerRequest) {
+		if plainErr := s.sendPlain(ctx, batch); plainErr != nil {
+			err = errors.Join(err, plainErr)
+		}
+	}
+
+	return err
+}
+
+// sendEncryptedWithRetry sends the messages encrypted and resends the ones failed by stale
+// sessions, it returns the messages to be sent plain as their recipients don't support encryption
+func (s *e2eSender) sendEncryptedWithRetry(ctx context.Context, pending []*MessageRequest) ([]*MessageRequest, error) {
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	recipients := make([]string, len(pending))
+	for i, msg := range pending {
+		recipients[i] = msg.RecipientID
+	}
+
+	sessions, err := s.cache.Fetch(ctx, s.client, recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	var plain []*MessageRequest
+	for retry := 0; len(pending) > 0; retry++ {
+		if retry > maxEncryptedMessageRetries {
+			return plain, fmt.Errorf("send encrypted messages: %d messages failed with stale sessions", len(pending))
+		}
+
+		var (
+			encrypted []*MessageRequest
+			origins   = map[string]*MessageRequest{}
+		)
+
+		for _, msg := range pending {
+			ss := sessions[msg.RecipientID]
+			if len(ss) == 0 || !IsEncryptedMessageSupported(ss) {
+				if s.requireEncrypted {
+					return plain, fmt.Errorf("sessions of %s don't support encrypted messages", msg.RecipientID)
+				}
+
+				plain = append(plain, msg)
+				continue
+			}
+
+			// EncryptMessageRequest modifies the request
+			req := *msg
+			req.RecipientSessions = nil
+			if err := s.client.EncryptMessageRequest(&req, ss); err != nil {
+				return plain, err
+			}
+
+			encrypted = append(encrypted, &req)
+			origins[req.MessageID] = msg
+		}
+
+		pending = nil
+		if len(encrypted) == 0 {
+			break
+		}
+
+		var receipts []*EncryptedMessageReceipt
+		for batch := range slices.Chunk(encrypted, maxMessagesPerRequest) {
+			r, err := s.sendEncrypted(ctx, batch)
+			if err != nil {
+				return plain, err
+			}
+
+			receipts = append(receipts, r...)
+		}
+
+		for _, receipt := range receipts {
+			if receipt.State != EncryptedMessageReceiptStateFailed {
+				continue
+			}
+
+			s.cache.Set(receipt.RecipientID, receipt.Sessions)
+			sessions[receipt.RecipientID] = receipt.Sessions
+			if msg, ok := origins[receipt.MessageID]; ok {
+				pending = append(pending, msg)
+			}
+		}
+	}
+
+	return plain, nil
+}
+
+// SendMessageE2E is same as SendMessagesE2E but sends one message
+func (c *Client) SendMessageE2E(ctx context.Context, cache *SessionCache, message *MessageRequest) error {
+	return c.SendMessagesE2E(ctx, cache, []*MessageRequest{message})
+}
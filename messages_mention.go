@@ -0,0 +1,135 @@
+package mixin
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// mentionRegexp matches @identity_number not preceded by a word character, e.g. emails
+var mentionRegexp = regexp.MustCompile(`(?:^|[^0-9A-Za-z_@])@(\d+)\b`)
+
+// ParseMentions returns the identity numbers mentioned in the content, duplicates removed
+func ParseMentions(content string) []string {
+	var (
+		numbers []string
+		seen    = make(map[string]bool)
+	)
+
+	for _, match := range mentionRegexp.FindAllStringSubmatch(content, -1) {
+		if number := match[1]; !seen[number] {
+			seen[number] = true
+			numbers = append(numbers, number)
+		}
+	}
+
+	return numbers
+}
+
+func isTextMessageCategory(category string) bool {
+	return strings.HasSuffix(category, "_TEXT") || strings.HasSuffix(category, "_POST")
+}
+
+// Mentions returns the identity numbers mentioned in the text or post message
+func (m *MessageView) Mentions() []string {
+	if !isTextMessageCategory(m.Category) {
+		return nil
+	}
+
+	data, err := m.RawData()
+	if err != nil {
+		return nil
+	}
+
+	return ParseMentions(string(data))
+}
+
+// IsMentioned reports whether the user with the identity number is mentioned in the message
+func (m *MessageView) IsMentioned(identityNumber string) bool {
+	for _, number := range m.Mentions() {
+		if number == identityNumber {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Quote returns the id of the message quoted by the message
+func (m *MessageView) Quote() (messageID string, ok bool) {
+	return m.QuoteMessageID, m.QuoteMessageID != ""
+}
+
+// maxResolveMentionsConcurrency limits the concurrent SearchUser calls of ResolveMentions
+const maxResolveMentionsConcurrency = 5
+
+// ResolveMentions finds the users by the identity numbers in order, duplicates are searched
+// only once and the ones not found are skipped
+func (c *Client) ResolveMentions(ctx context.Context, identityNumbers []string) ([]*User, error) {
+	var (
+		numbers []string
+		seen    = make(map[string]bool, len(identityNumbers))
+	)
+
+	for _, number := range identityNumbers {
+		if !seen[number] {
+			seen[number] = true
+			numbers = append(numbers, number)
+		}
+	}
+
+	found := make([]*User, len(numbers))
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxResolveMentionsConcurrency)
+	for i, number := range numbers {
+		g.Go(func() error {
+			user, err := c.SearchUser(ctx, number)
+			if err != nil {
+				if IsErrorCodes(err, EndpointNotFound) {
+					return nil
+				}
+
+				return err
+			}
+
+			found[i] = user
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	users := make([]*User, 0, len(found))
+	for _, user := range found {
+		if user != nil {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+// addMentions prepends the mentions not in the content yet
+func addMentions(content string, identityNumbers []string) string {
+	mentioned := make(map[string]bool)
+	for _, number := range ParseMentions(content) {
+		mentioned[number] = true
+	}
+
+	var b strings.Builder
+	for _, number := range identityNumbers {
+		if number == "" || mentioned[number] {
+			continue
+		}
+
+		mentioned[number] = true
+		b.WriteString("@" + number + " ")
+	}
+
+	return b.String() + content
+}
@@ -0,0 +1,83 @@
+package mixin
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMentions(t *testing.T) {
+	assert.Equal(t, []string{"7000101", "25566"}, ParseMentions("@7000101 hi @25566, and @7000101 again"))
+	assert.Empty(t, ParseMentions("mail me at bot@7000101.com or a@123"))
+	assert.Empty(t, ParseMentions("@123abc"))
+	assert.Equal(t, []string{"42"}, ParseMentions("(@42)"))
+}
+
+func TestMessageMentionsAndQuote(t *testing.T) {
+	quoteID := newUUID()
+
+	msg, err := NewTextMessage(newUUID(), "@100 ping", WithMentions("100", "200"), WithQuote(quoteID))
+	require.NoError(t, err)
+	assert.Equal(t, quoteID, msg.QuoteMessageID)
+
+	view := &MessageView{Category: msg.Category, Data: msg.Data, QuoteMessageID: msg.QuoteMessageID}
+	data, err := view.RawData()
+	require.NoError(t, err)
+	assert.Equal(t, "@200 @100 ping", string(data))
+	assert.Equal(t, []string{"200", "100"}, view.Mentions())
+	assert.True(t, view.IsMentioned("100"))
+	assert.False(t, view.IsMentioned("300"))
+
+	id, ok := view.Quote()
+	assert.True(t, ok)
+	assert.Equal(t, quoteID, id)
+
+	image := &MessageView{Category: MessageCategoryPlainImage, Data: base64.StdEncoding.EncodeToString([]byte("@100"))}
+	assert.Empty(t, image.Mentions())
+
+	_, err = NewTextMessage(newUUID(), "hi", WithQuote("bad"))
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+}
+
+func TestResolveMentions(t *testing.T) {
+	var (
+		mux   sync.Mutex
+		calls = map[string]int{}
+	)
+
+	newTestAPIServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		number := strings.TrimPrefix(r.URL.Path, "/search/")
+		mux.Lock()
+		calls[number]++
+		mux.Unlock()
+
+		switch number {
+		case "7000", "7001":
+			writeTestAPIData(w, User{UserID: newUUID(), IdentityNumber: number})
+		case "500":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": Error{Status: http.StatusAccepted, Code: EndpointNotFound, Description: "not found"},
+			})
+		}
+	}))
+
+	c := NewFromAccessToken("token")
+	users, err := c.ResolveMentions(context.Background(), []string{"7001", "404", "7000", "7001", "7000"})
+	require.NoError(t, err)
+	require.Len(t, users, 2, "not found skipped")
+	assert.Equal(t, "7001", users[0].IdentityNumber)
+	assert.Equal(t, "7000", users[1].IdentityNumber)
+	assert.Equal(t, map[string]int{"7000": 1, "7001": 1, "404": 1}, calls, "searched once")
+
+	_, err = c.ResolveMentions(context.Background(), []string{"7000", "500"})
+	assert.Error(t, err)
+}
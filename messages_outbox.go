@@ -0,0 +1,417 @@
+package mixin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxMessagesPerRequest is the limit of messages sent by one SendMessages call
+const maxMessagesPerRequest = 100
+
+// OutboxStore persists messages waiting to be sent by the Outbox
+type OutboxStore interface {
+	// AddOutboxMessages saves the messages, messages with the same id are replaced
+	AddOutboxMessages(ctx context.Context, messages []*MessageRequest) error
+	// RemoveOutboxMessages drops messages that have been delivered or failed
+	RemoveOutboxMessages(ctx context.Context, messageIDs []string) error
+	// ListOutboxMessages returns at most limit messages in the order they were added
+	ListOutboxMessages(ctx context.Context, limit int) ([]*MessageRequest, error)
+}
+
+type OutboxConfig struct {
+	// BatchSize is the number of messages sent in one request, default and max is 100
+	BatchSize int
+	// RetryInterval is the delay after transient errors, doubled every retry
+	// up to MaxRetryInterval. Default is 1 second and 1 minute
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+	// PollInterval is the interval checking the store when it is empty, default is 1 second
+	PollInterval time.Duration
+	// OnDelivered is called after the message was accepted by the api
+	OnDelivered func(ctx context.Context, msg *MessageRequest)
+	// OnFailed is called if the message was rejected by the api, it won't be sent again
+	OnFailed func(ctx context.Context, msg *MessageRequest, err error)
+}
+
+// Outbox sends messages persisted in an OutboxStore until they are delivered,
+// the message ids are kept across retries so the messages are sent only once
+type Outbox struct {
+	client *Client
+	store  OutboxStore
+	cfg    OutboxConfig
+	notify chan struct{}
+
+	// send is SendMessages of the client, replaced in tests
+	send func(ctx context.Context, messages []*MessageRequest) error
+}
+
+func NewOutbox(client *Client, store OutboxStore, cfg OutboxConfig) *Outbox {
+	if cfg.BatchSize <= 0 || cfg.BatchSize > maxMessagesPerRequest {
+		cfg.BatchSize = maxMessagesPerRequest
+	}
+
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = time.Second
+	}
+
+	if cfg.MaxRetryInterval < cfg.RetryInterval {
+		cfg.MaxRetryInterval = time.Minute
+	}
+
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+
+	return &Outbox{
+		client: client,
+		store:  store,
+		cfg:    cfg,
+		notify: make(chan struct{}, 1),
+		send:   client.SendMessages,
+	}
+}
+
+// Enqueue persists the messages, the message id is generated if empty
+func (o *Outbox) Enqueue(ctx context.Context, messages ...*MessageRequest) error {
+	for _, msg := range messages {
+		if msg.MessageID == "" {
+			msg.MessageID = newUUID()
+		}
+
+		if o.client != nil {
+			o.client.fillConversationID(msg)
+		}
+	}
+
+	if err := o.store.AddOutboxMessages(ctx, messages); err != nil {
+		return err
+	}
+
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// IsTransientError reports whether the request failed by network errors,
+// server errors or rate limits and is worth retrying
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var e *Error
+	if !errors.As(err, &e) {
+		return !errors.Is(err, context.Canceled)
+	}
+
+	return e.Status >= http.StatusInternalServerError ||
+		e.Status == http.StatusTooManyRequests ||
+		e.Code == http.StatusTooManyRequests ||
+		(e.Code >= http.StatusInternalServerError && e.Code < 600)
+}
+
+// Run sends the messages in the store until ctx is done
+func (o *Outbox) Run(ctx context.Context) error {
+	interval := o.cfg.RetryInterval
+
+	for {
+		n, err := o.flush(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var wait time.Duration
+		switch {
+		case err != nil:
+			wait = interval
+			if interval *= 2; interval > o.cfg.MaxRetryInterval {
+				interval = o.cfg.MaxRetryInterval
+			}
+		case n < o.cfg.BatchSize:
+			interval = o.cfg.RetryInterval
+			wait = o.cfg.PollInterval
+		default:
+			interval = o.cfg.RetryInterval
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-o.notify:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Flush sends all the messages in the store once, transient errors are returned
+func (o *Outbox) Flush(ctx context.Context) error {
+	for {
+		n, err := o.flush(ctx)
+		if err != nil || n < o.cfg.BatchSize {
+			return err
+		}
+	}
+}
+
+// flush sends one batch and returns the number of messages handled
+func (o *Outbox) flush(ctx context.Context) (int, error) {
+	messages, err := o.store.ListOutboxMessages(ctx, o.cfg.BatchSize)
+	if err != nil || len(messages) == 0 {
+		return 0, err
+	}
+
+	err = o.send(ctx, messages)
+	if err == nil {
+		return len(messages), o.done(ctx, messages, nil)
+	}
+
+	if IsTransientError(err) {
+		return 0, err
+	}
+
+	if len(messages) == 1 {
+		return 1, o.done(ctx, messages, err)
+	}
+
+	return sendMessagesOneByOne(ctx, messages, 0, o.send, func(msg *MessageRequest, err error) error {
+		return o.done(ctx, []*MessageRequest{msg}, err)
+	})
+}
+
+// sendMessagesOneByOne sends the messages of a rejected batch one by one, at most one
+// every interval, to find out the rejected ones. done is called with the result of every
+// message, it stops at transient errors and returns the number of messages done.
+func sendMessagesOneByOne(
+	ctx context.Context,
+	messages []*MessageRequest,
+	interval time.Duration,
+	send func(ctx context.Context, messages []*MessageRequest) error,
+	done func(msg *MessageRequest, err error) error,
+) (int, error) {
+	for idx, msg := range messages {
+		if idx > 0 {
+			if err := sleepContext(ctx, interval); err != nil {
+				return idx, err
+			}
+		}
+
+		err := send(ctx, []*MessageRequest{msg})
+		if IsTransientError(err) || (err != nil && ctx.Err() != nil) {
+			return idx, err
+		}
+
+		if err := done(msg, err); err != nil {
+			return idx, err
+		}
+	}
+
+	return len(messages), nil
+}
+
+func (o *Outbox) done(ctx context.Context, messages []*MessageRequest, sendErr error) error {
+	ids := make([]string, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.MessageID
+	}
+
+	if err := o.store.RemoveOutboxMessages(ctx, ids); err != nil {
+		return err
+	}
+
+	for _, msg := range messages {
+		if sendErr == nil {
+			if o.cfg.OnDelivered != nil {
+				o.cfg.OnDelivered(ctx, msg)
+			}
+		} else if o.cfg.OnFailed != nil {
+			o.cfg.OnFailed(ctx, msg, sendErr)
+		}
+	}
+
+	return nil
+}
+
+type memoryOutboxStore struct {
+	seq      uint64
+	messages map[string]*outboxMessage
+	mux      sync.Mutex
+}
+
+type outboxMessage struct {
+	seq uint64
+	msg *MessageRequest
+}
+
+// NewMemoryOutboxStore returns an OutboxStore living in memory
+func NewMemoryOutboxStore() OutboxStore {
+	return newMemoryOutboxStore()
+}
+
+func newMemoryOutboxStore() *memoryOutboxStore {
+	return &memoryOutboxStore{
+		messages: make(map[string]*outboxMessage),
+	}
+}
+
+func (s *memoryOutboxStore) add(msg *MessageRequest) {
+	if m, ok := s.messages[msg.MessageID]; ok {
+		m.msg = msg
+		return
+	}
+
+	s.seq++
+	s.messages[msg.MessageID] = &outboxMessage{seq: s.seq, msg: msg}
+}
+
+func (s *memoryOutboxStore) AddOutboxMessages(_ context.Context, messages []*MessageRequest) error {
+	s.mux.Lock()
+	for _, msg := range messages {
+		s.add(msg)
+	}
+	s.mux.Unlock()
+	return nil
+}
+
+func (s *memoryOutboxStore) RemoveOutboxMessages(_ context.Context, messageIDs []string) error {
+	s.mux.Lock()
+	for _, id := range messageIDs {
+		delete(s.messages, id)
+	}
+	s.mux.Unlock()
+	return nil
+}
+
+func (s *memoryOutboxStore) ListOutboxMessages(_ context.Context, limit int) ([]*MessageRequest, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	sorted := make([]*outboxMessage, 0, len(s.messages))
+	for _, m := range s.messages {
+		sorted = append(sorted, m)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].seq < sorted[j].seq
+	})
+
+	if limit > 0 && len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+
+	messages := make([]*MessageRequest, len(sorted))
+	for i, m := range sorted {
+		messages[i] = m.msg
+	}
+
+	return messages, nil
+}
+
+const (
+	outboxJournalAdd    = "add"
+	outboxJournalRemove = "remove"
+)
+
+type outboxJournalEntry struct {
+	Op        string          `json:"op"`
+	MessageID string          `json:"message_id"`
+	Message   *MessageRequest `json:"message,omitempty"`
+}
+
+// FileOutboxStore is an OutboxStore persisted as an append only journal file
+type FileOutboxStore struct {
+	*memoryOutboxStore
+	journal *journal[outboxJournalEntry]
+}
+
+// NewFileOutboxStore opens the journal file at path,
+// the journal is compacted every time the store is opened
+func NewFileOutboxStore(path string) (*FileOutboxStore, error) {
+	s := &FileOutboxStore{
+		memoryOutboxStore: newMemoryOutboxStore(),
+	}
+
+	j, err := openJournal(path, 16*1024*1024, s.apply, s.snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	s.journal = j
+	return s, nil
+}
+
+func (s *FileOutboxStore) apply(entry outboxJournalEntry) {
+	switch entry.Op {
+	case outboxJournalAdd:
+		if entry.Message != nil {
+			s.add(entry.Message)
+		}
+	case outboxJournalRemove:
+		delete(s.messages, entry.MessageID)
+	}
+}
+
+func (s *FileOutboxStore) snapshot() []outboxJournalEntry {
+	messages, _ := s.memoryOutboxStore.ListOutboxMessages(context.Background(), 0)
+	entries := make([]outboxJournalEntry, len(messages))
+	for i, msg := range messages {
+		entries[i] = outboxJournalEntry{Op: outboxJournalAdd, MessageID: msg.MessageID, Message: msg}
+	}
+
+	return entries
+}
+
+func (s *FileOutboxStore) AddOutboxMessages(_ context.Context, messages []*MessageRequest) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	entries := make([]outboxJournalEntry, len(messages))
+	for i, msg := range messages {
+		entries[i] = outboxJournalEntry{Op: outboxJournalAdd, MessageID: msg.MessageID, Message: msg}
+	}
+
+	if err := s.journal.write(entries...); err != nil {
+		return err
+	}
+
+	for _, msg := range messages {
+		s.add(msg)
+	}
+
+	return nil
+}
+
+func (s *FileOutboxStore) RemoveOutboxMessages(_ context.Context, messageIDs []string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	entries := make([]outboxJournalEntry, len(messageIDs))
+	for i, id := range messageIDs {
+		entries[i] = outboxJournalEntry{Op: outboxJournalRemove, MessageID: id}
+	}
+
+	if err := s.journal.write(entries...); err != nil {
+		return err
+	}
+
+	for _, id := range messageIDs {
+		delete(s.messages, id)
+	}
+
+	return nil
+}
+
+// Close closes the journal file
+func (s *FileOutboxStore) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.journal.Close()
+}
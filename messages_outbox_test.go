@@ -0,0 +1,102 @@
+package mixin
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutbox(t *testing.T) {
+	ctx := context.Background()
+	rejected := newUUID()
+
+	var (
+		delivered []string
+		failed    []string
+		calls     int
+	)
+
+	outbox := NewOutbox(&Client{}, NewMemoryOutboxStore(), OutboxConfig{
+		BatchSize: 3,
+		OnDelivered: func(_ context.Context, msg *MessageRequest) {
+			delivered = append(delivered, msg.MessageID)
+		},
+		OnFailed: func(_ context.Context, msg *MessageRequest, err error) {
+			failed = append(failed, msg.MessageID)
+		},
+	})
+
+	outbox.send = func(_ context.Context, messages []*MessageRequest) error {
+		calls++
+		if calls == 1 {
+			return errors.New("connection reset")
+		}
+
+		for _, msg := range messages {
+			if msg.MessageID == rejected {
+				return createError(202, 10002, "invalid data")
+			}
+		}
+
+		return nil
+	}
+
+	var messages []*MessageRequest
+	for i := 0; i < 5; i++ {
+		messages = append(messages, &MessageRequest{RecipientID: newUUID(), Category: MessageCategoryPlainText})
+	}
+	messages[1].MessageID = rejected
+	require.NoError(t, outbox.Enqueue(ctx, messages...))
+	assert.NotEmpty(t, messages[0].MessageID)
+
+	err := outbox.Flush(ctx)
+	assert.True(t, IsTransientError(err))
+	assert.Empty(t, delivered)
+
+	require.NoError(t, outbox.Flush(ctx))
+	assert.Equal(t, []string{rejected}, failed)
+	assert.Equal(t, []string{messages[0].MessageID, messages[2].MessageID, messages[3].MessageID, messages[4].MessageID}, delivered)
+
+	left, err := outbox.store.ListOutboxMessages(ctx, 0)
+	require.NoError(t, err)
+	assert.Empty(t, left)
+}
+
+func TestIsTransientError(t *testing.T) {
+	assert.False(t, IsTransientError(nil))
+	assert.True(t, IsTransientError(errors.New("timeout")))
+	assert.True(t, IsTransientError(createError(500, 500, "internal")))
+	assert.True(t, IsTransientError(createError(429, 429, "too many requests")))
+	assert.False(t, IsTransientError(createError(202, 401, "unauthorized")))
+	assert.False(t, IsTransientError(context.Canceled))
+}
+
+func TestFileOutboxStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "outbox")
+
+	store, err := NewFileOutboxStore(path)
+	require.NoError(t, err)
+
+	a := &MessageRequest{MessageID: newUUID(), Data: "a"}
+	b := &MessageRequest{MessageID: newUUID(), Data: "b"}
+	c := &MessageRequest{MessageID: newUUID(), Data: "c"}
+	require.NoError(t, store.AddOutboxMessages(ctx, []*MessageRequest{a, b, c}))
+	require.NoError(t, store.RemoveOutboxMessages(ctx, []string{b.MessageID}))
+	require.NoError(t, store.Close())
+
+	store, err = NewFileOutboxStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	messages, err := store.ListOutboxMessages(ctx, 10)
+	require.NoError(t, err)
+	if assert.Len(t, messages, 2) {
+		assert.Equal(t, a.MessageID, messages[0].MessageID)
+		assert.Equal(t, c.MessageID, messages[1].MessageID)
+	}
+}
@@ -0,0 +1,380 @@
+package mixin
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// TranscriptItem is a message in the transcript, Children are
+// the messages of the nested transcript if Category is PLAIN_TRANSCRIPT
+type TranscriptItem struct {
+	TranscriptMessage
+	Children []*TranscriptItem `json:"-"`
+}
+
+func isAttachmentCategory(category string) bool {
+	for _, suffix := range []string{"_IMAGE", "_DATA", "_VIDEO", "_AUDIO"} {
+		if strings.HasSuffix(category, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TranscriptMention is a user mentioned by a transcript message, encoded in TranscriptMessage.Mentions
+type TranscriptMention struct {
+	IdentityNumber string `json:"identity_number"`
+	FullName       string `json:"full_name,omitempty"`
+}
+
+type transcriptItemOptions struct {
+	quote *TranscriptMessage
+	users map[string]*User
+}
+
+// TranscriptItemOption customizes the item built by NewTranscriptItem
+type TranscriptItemOption func(opts *transcriptItemOptions)
+
+// WithTranscriptQuote fills the quote content with the message quoted by the item
+func WithTranscriptQuote(quote *TranscriptItem) TranscriptItemOption {
+	return func(opts *transcriptItemOptions) {
+		opts.quote = &quote.TranscriptMessage
+	}
+}
+
+// WithTranscriptMentionUsers fills the full names of the mentioned users,
+// the users could be resolved by Client.ResolveMentions
+func WithTranscriptMentionUsers(users []*User) TranscriptItemOption {
+	return func(opts *transcriptItemOptions) {
+		if opts.users == nil {
+			opts.users = make(map[string]*User, len(users))
+		}
+
+		for _, user := range users {
+			opts.users[user.IdentityNumber] = user
+		}
+	}
+}
+
+// NewTranscriptItem converts the message to a transcript item, the users mentioned
+// by text messages are kept in Mentions
+func NewTranscriptItem(msg *MessageView, userFullName string, opts ...TranscriptItemOption) (*TranscriptItem, error) {
+	var o transcriptItemOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	item := &TranscriptItem{
+		TranscriptMessage: TranscriptMessage{
+			MessageID:    msg.MessageID,
+			UserID:       msg.UserID,
+			UserFullName: userFullName,
+			Category:     msg.Category,
+			QuoteID:      msg.QuoteMessageID,
+			CreatedAt:    msg.CreatedAt,
+		},
+	}
+
+	payload, err := msg.Decode()
+	if err != nil {
+		return nil, err
+	}
+
+	t := &item.TranscriptMessage
+	setEncrypt := func(encrypt *AttachmentMessageEncrypt) {
+		if encrypt != nil {
+			t.MediaKey = base64.StdEncoding.EncodeToString(encrypt.Key)
+			t.MediaDigest = base64.StdEncoding.EncodeToString(encrypt.Digest)
+		}
+	}
+
+	if o.quote != nil {
+		if msg.QuoteMessageID != "" && o.quote.MessageID != msg.QuoteMessageID {
+			return nil, invalidMessageError("quote %s is not %s", o.quote.MessageID, msg.QuoteMessageID)
+		}
+
+		quote := *o.quote
+		quote.TranscriptID = ""
+		data, err := json.Marshal(quote)
+		if err != nil {
+			return nil, err
+		}
+
+		t.QuoteID = quote.MessageID
+		t.QuoteContent = string(data)
+	}
+
+	switch v := payload.(type) {
+	case string:
+		t.Content = v
+		if isTextMessageCategory(msg.Category) {
+			if err := setTranscriptMentions(t, ParseMentions(v), o.users); err != nil {
+				return nil, err
+			}
+		}
+	case *ImageMessage:
+		t.Content = v.AttachmentID
+		t.MediaMimeType = v.MimeType
+		t.MediaSize = v.Size
+		t.MediaWidth = v.Width
+		t.MediaHeight = v.Height
+		t.ThumbImage = v.Thumbnail
+		setEncrypt(v.AttachmentMessageEncrypt)
+	case *DataMessage:
+		t.Content = v.AttachmentID
+		t.MediaMimeType = v.MimeType
+		t.MediaSize = v.Size
+		t.MediaName = v.Name
+		setEncrypt(v.AttachmentMessageEncrypt)
+	case *VideoMessage:
+		t.Content = v.AttachmentID
+		t.MediaMimeType = v.MimeType
+		t.MediaSize = v.Size
+		t.MediaWidth = v.Width
+		t.MediaHeight = v.Height
+		t.MediaDuration = v.Duration
+		if len(v.Thumbnail) > 0 {
+			t.ThumbImage = base64.StdEncoding.EncodeToString(v.Thumbnail)
+		}
+		setEncrypt(v.AttachmentMessageEncrypt)
+	case *AudioMessage:
+		t.Content = v.AttachmentID
+		t.MediaMimeType = v.MimeType
+		t.MediaSize = v.Size
+		t.MediaDuration = v.Duration
+		t.MediaWaveform = v.WaveForm
+		setEncrypt(v.AttachmentMessageEncrypt)
+	case *StickerMessage:
+		t.StickerID = v.StickerID
+	case *ContactMessage:
+		t.SharedUserID = v.UserID
+	case []TranscriptMessage:
+		children, err := ParseTranscript(msg.MessageID, v)
+		if err != nil {
+			return nil, err
+		}
+
+		item.Children = children
+	default:
+		// location, live, app card etc. are kept as the raw json
+		data, err := msg.RawData()
+		if err != nil {
+			return nil, err
+		}
+
+		t.Content = string(data)
+	}
+
+	return item, nil
+}
+
+func setTranscriptMentions(t *TranscriptMessage, numbers []string, users map[string]*User) error {
+	if len(numbers) == 0 {
+		return nil
+	}
+
+	mentions := make([]TranscriptMention, len(numbers))
+	for i, number := range numbers {
+		mentions[i].IdentityNumber = number
+		if user, ok := users[number]; ok {
+			mentions[i].FullName = user.FullName
+		}
+	}
+
+	data, err := json.Marshal(mentions)
+	if err != nil {
+		return err
+	}
+
+	t.Mentions = string(data)
+	return nil
+}
+
+// MentionUsers decodes the users mentioned by the message
+func (t *TranscriptMessage) MentionUsers() ([]TranscriptMention, error) {
+	if t.Mentions == "" {
+		return nil, nil
+	}
+
+	var mentions []TranscriptMention
+	if err := json.Unmarshal([]byte(t.Mentions), &mentions); err != nil {
+		return nil, err
+	}
+
+	return mentions, nil
+}
+
+// Quote decodes the message quoted by the message, nil if no quote content
+func (t *TranscriptMessage) Quote() (*TranscriptMessage, error) {
+	if t.QuoteContent == "" {
+		return nil, nil
+	}
+
+	var quote TranscriptMessage
+	if err := json.Unmarshal([]byte(t.QuoteContent), &quote); err != nil {
+		return nil, err
+	}
+
+	return &quote, nil
+}
+
+// NewTranscriptMessage builds a transcript message of the items, the transcript id
+// of the items is set to the message id, nested transcripts are flattened
+func NewTranscriptMessage(recipientID string, items []*TranscriptItem, opts ...MessageOption) (*MessageRequest, error) {
+	if len(items) == 0 {
+		return nil, invalidMessageError("empty transcript")
+	}
+
+	msg, err := newMessageRequest(recipientID, MessageCategoryPlainTranscript, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []TranscriptMessage
+	if err := flattenTranscript(msg.MessageID, items, &messages); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(messages)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Data = base64.StdEncoding.EncodeToString(data)
+	return msg, nil
+}
+
+func flattenTranscript(transcriptID string, items []*TranscriptItem, messages *[]TranscriptMessage) error {
+	for idx, item := range items {
+		if item.MessageID == "" || item.Category == "" {
+			return invalidMessageError("transcript item %d message id and category required", idx)
+		}
+
+		t := item.TranscriptMessage
+		t.TranscriptID = transcriptID
+		*messages = append(*messages, t)
+
+		if len(item.Children) > 0 {
+			if !strings.HasSuffix(item.Category, "_TRANSCRIPT") {
+				return invalidMessageError("transcript item %d with children is not a transcript", idx)
+			}
+
+			if err := flattenTranscript(item.MessageID, item.Children, messages); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ParseTranscript rebuilds the items of the transcript transcriptID from the flattened messages
+func ParseTranscript(transcriptID string, messages []TranscriptMessage) ([]*TranscriptItem, error) {
+	children := make(map[string][]*TranscriptItem)
+	for _, m := range messages {
+		children[m.TranscriptID] = append(children[m.TranscriptID], &TranscriptItem{TranscriptMessage: m})
+	}
+
+	var (
+		used  int
+		build func(id string, depth int) []*TranscriptItem
+	)
+
+	build = func(id string, depth int) []*TranscriptItem {
+		items := children[id]
+		used += len(items)
+		// guard against cycles
+		if depth > 16 {
+			return items
+		}
+
+		for _, item := range items {
+			if strings.HasSuffix(item.Category, "_TRANSCRIPT") && item.MessageID != id {
+				item.Children = build(item.MessageID, depth+1)
+			}
+		}
+
+		return items
+	}
+
+	items := build(transcriptID, 0)
+	if used != len(messages) {
+		return nil, invalidMessageError("transcript %s has %d orphan messages", transcriptID, len(messages)-used)
+	}
+
+	return items, nil
+}
+
+// Transcript parses the PLAIN_TRANSCRIPT message into its messages
+func (m *MessageView) Transcript() ([]*TranscriptItem, error) {
+	if m.Category != MessageCategoryPlainTranscript {
+		return nil, invalidMessageError("%s is not a transcript", m.Category)
+	}
+
+	data, err := m.RawData()
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []TranscriptMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return nil, err
+	}
+
+	return ParseTranscript(m.MessageID, messages)
+}
+
+// ReuploadTranscriptAttachments copies the attachments of the items, nested ones
+// included, to new attachments owned by the client, so the transcript could be
+// forwarded to other conversations. Encrypted attachments are copied as they are,
+// the media key and digest are still valid.
+func (c *Client) ReuploadTranscriptAttachments(ctx context.Context, items []*TranscriptItem) error {
+	for _, item := range items {
+		if err := c.ReuploadTranscriptAttachments(ctx, item.Children); err != nil {
+			return err
+		}
+
+		if !isAttachmentCategory(item.Category) || item.Content == "" {
+			continue
+		}
+
+		attachmentID, err := c.copyAttachment(ctx, item.Content)
+		if err != nil {
+			return err
+		}
+
+		item.Content = attachmentID
+		item.MediaURL = ""
+	}
+
+	return nil
+}
+
+// copyAttachment streams the attachment to a new one, the content is never held in memory
+func (c *Client) copyAttachment(ctx context.Context, attachmentID string) (string, error) {
+	source, err := c.ShowAttachment(ctx, attachmentID)
+	if err != nil {
+		return "", err
+	}
+
+	r, size, err := downloadAttachmentFrom(ctx, source.ViewURL)
+	if err != nil {
+		return "", err
+	}
+
+	defer r.Close()
+
+	attachment, err := c.CreateAttachment(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err := UploadAttachmentReader(ctx, attachment, r, size); err != nil {
+		return "", err
+	}
+
+	return attachment.AttachmentID, nil
+}
@@ -0,0 +1,137 @@
+package mixin
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranscriptRoundTrip(t *testing.T) {
+	image, _ := json.Marshal(ImageMessage{AttachmentID: newUUID(), MimeType: "image/png", Width: 1, Height: 1, Size: 10})
+
+	imageItem, err := NewTranscriptItem(&MessageView{
+		MessageID: newUUID(),
+		UserID:    newUUID(),
+		Category:  MessageCategoryPlainImage,
+		Data:      base64.StdEncoding.EncodeToString(image),
+	}, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", imageItem.MediaMimeType)
+	assert.NotEmpty(t, imageItem.Content)
+
+	textItem, err := NewTranscriptItem(&MessageView{
+		MessageID:      newUUID(),
+		UserID:         newUUID(),
+		Category:       MessageCategoryPlainText,
+		Data:           base64.StdEncoding.EncodeToString([]byte("@7000 @7001 hello")),
+		QuoteMessageID: imageItem.MessageID,
+	}, "bob", WithTranscriptQuote(imageItem), WithTranscriptMentionUsers([]*User{{IdentityNumber: "7000", FullName: "alice"}}))
+	require.NoError(t, err)
+	assert.Equal(t, "@7000 @7001 hello", textItem.Content)
+	assert.Equal(t, imageItem.MessageID, textItem.QuoteID)
+
+	_, err = NewTranscriptItem(&MessageView{
+		MessageID:      newUUID(),
+		Category:       MessageCategoryPlainText,
+		Data:           base64.StdEncoding.EncodeToString([]byte("hi")),
+		QuoteMessageID: newUUID(),
+	}, "bob", WithTranscriptQuote(imageItem))
+	assert.ErrorIs(t, err, ErrInvalidMessage, "quote not matched")
+
+	nested := &TranscriptItem{
+		TranscriptMessage: TranscriptMessage{MessageID: newUUID(), Category: MessageCategoryPlainTranscript},
+		Children:          []*TranscriptItem{imageItem},
+	}
+
+	msg, err := NewTranscriptMessage(newUUID(), []*TranscriptItem{textItem, nested})
+	require.NoError(t, err)
+
+	view := &MessageView{MessageID: msg.MessageID, Category: msg.Category, Data: msg.Data}
+	items, err := view.Transcript()
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, msg.MessageID, items[0].TranscriptID)
+	assert.Equal(t, "@7000 @7001 hello", items[0].Content)
+
+	mentions, err := items[0].MentionUsers()
+	require.NoError(t, err)
+	assert.Equal(t, []TranscriptMention{{IdentityNumber: "7000", FullName: "alice"}, {IdentityNumber: "7001"}}, mentions)
+
+	quote, err := items[0].Quote()
+	require.NoError(t, err)
+	require.NotNil(t, quote)
+	assert.Equal(t, imageItem.MessageID, quote.MessageID)
+	assert.Equal(t, imageItem.Content, quote.Content)
+	assert.Equal(t, "image/png", quote.MediaMimeType)
+	require.Len(t, items[1].Children, 1)
+	assert.Equal(t, nested.MessageID, items[1].Children[0].TranscriptID)
+	assert.Equal(t, imageItem.Content, items[1].Children[0].Content)
+
+	// a forwarded transcript keeps its children
+	forwarded, err := NewTranscriptItem(view, "carol")
+	require.NoError(t, err)
+	assert.Len(t, forwarded.Children, 2)
+
+	_, err = ParseTranscript(newUUID(), []TranscriptMessage{{TranscriptID: newUUID(), MessageID: newUUID()}})
+	assert.ErrorIs(t, err, ErrInvalidMessage, "orphan")
+
+	_, err = NewTranscriptMessage(newUUID(), []*TranscriptItem{{
+		TranscriptMessage: TranscriptMessage{MessageID: newUUID(), Category: MessageCategoryPlainText},
+		Children:          []*TranscriptItem{textItem},
+	}})
+	assert.ErrorIs(t, err, ErrInvalidMessage)
+}
+
+func TestReuploadTranscriptAttachments(t *testing.T) {
+	data := bytes.Repeat([]byte("video"), 1024)
+	source := newUUID()
+
+	var (
+		srv      *httptest.Server
+		uploaded []byte
+		length   int64
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/attachments/"+source, func(w http.ResponseWriter, r *http.Request) {
+		writeTestAPIData(w, Attachment{AttachmentID: source, ViewURL: srv.URL + "/view"})
+	})
+	mux.HandleFunc("/view", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		_, _ = w.Write(data)
+	})
+	mux.HandleFunc("/attachments", func(w http.ResponseWriter, r *http.Request) {
+		writeTestAPIData(w, Attachment{AttachmentID: "copied", UploadURL: srv.URL + "/upload"})
+	})
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		length = r.ContentLength
+		uploaded, _ = io.ReadAll(r.Body)
+	})
+	srv = newTestAPIServer(t, mux)
+
+	video := &TranscriptItem{TranscriptMessage: TranscriptMessage{
+		MessageID: newUUID(),
+		Category:  MessageCategoryPlainVideo,
+		Content:   source,
+		MediaURL:  "https://example.com/video",
+	}}
+	nested := &TranscriptItem{
+		TranscriptMessage: TranscriptMessage{MessageID: newUUID(), Category: MessageCategoryPlainTranscript},
+		Children:          []*TranscriptItem{video},
+	}
+
+	require.NoError(t, NewFromAccessToken("token").ReuploadTranscriptAttachments(context.Background(), []*TranscriptItem{nested}))
+	assert.Equal(t, "copied", video.Content)
+	assert.Empty(t, video.MediaURL)
+	assert.Equal(t, data, uploaded)
+	assert.Equal(t, int64(len(data)), length, "streamed with the known size")
+}
@@ -2,6 +2,7 @@ package mixin
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -67,3 +68,85 @@ func (c *Client) SafeFetchAssets(ctx context.Context, assetIds []string) ([]*Saf
 func SafeFetchAssets(ctx context.Context, accessToken string, assetIds []string) ([]*SafeAsset, error) {
 	return NewFromAccessToken(accessToken).SafeFetchAssets(ctx, assetIds)
 }
+
+// SafeWithdrawalFee is a fee option of withdrawing an asset, the fee could be paid by any of the options
+type SafeWithdrawalFee struct {
+	Type    string          `json:"type,omitempty"`
+	FeeID   string          `json:"fee_id,omitempty"`
+	AssetID string          `json:"asset_id,omitempty"`
+	Amount  decimal.Decimal `json:"amount,omitempty"`
+}
+
+// SafeReadWithdrawalFees returns the fee options of withdrawing the asset to the destination,
+// the destination is optional but the fees may vary by destination
+func (c *Client) SafeReadWithdrawalFees(ctx context.Context, assetID, destination string) ([]*SafeWithdrawalFee, error) {
+	uri := fmt.Sprintf("/safe/assets/%s/fees", assetID)
+
+	params := make(map[string]string)
+	if destination != "" {
+		params["destination"] = destination
+	}
+
+	var fees []*SafeWithdrawalFee
+	if err := c.Get(ctx, uri, params, &fees); err != nil {
+		return nil, err
+	}
+
+	return fees, nil
+}
+
+// CheapestWithdrawalFee returns the fee option with the lowest usd value according to the
+// prices of the assets, options without price are picked only if none is priced
+func CheapestWithdrawalFee(fees []*SafeWithdrawalFee, assets []*SafeAsset) (*SafeWithdrawalFee, error) {
+	if len(fees) == 0 {
+		return nil, errors.New("no withdrawal fee available")
+	}
+
+	prices := make(map[string]decimal.Decimal, len(assets))
+	for _, asset := range assets {
+		prices[asset.AssetID] = asset.PriceUSD
+	}
+
+	var (
+		cheapest *SafeWithdrawalFee
+		lowest   decimal.Decimal
+	)
+
+	for _, fee := range fees {
+		price, ok := prices[fee.AssetID]
+		if !ok || !price.IsPositive() {
+			continue
+		}
+
+		if value := fee.Amount.Mul(price); cheapest == nil || value.LessThan(lowest) {
+			cheapest, lowest = fee, value
+		}
+	}
+
+	if cheapest == nil {
+		return fees[0], nil
+	}
+
+	return cheapest, nil
+}
+
+// SafeCheapestWithdrawalFee reads the fee options and the prices of the fee assets,
+// then returns the cheapest option by usd value
+func (c *Client) SafeCheapestWithdrawalFee(ctx context.Context, assetID, destination string) (*SafeWithdrawalFee, error) {
+	fees, err := c.SafeReadWithdrawalFees(ctx, assetID, destination)
+	if err != nil {
+		return nil, err
+	}
+
+	assetIDs := make([]string, len(fees))
+	for i, fee := range fees {
+		assetIDs[i] = fee.AssetID
+	}
+
+	assets, err := c.SafeFetchAssets(ctx, assetIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return CheapestWithdrawalFee(fees, assets)
+}
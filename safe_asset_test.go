@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -27,3 +29,26 @@ func TestSafeAssets(t *testing.T) {
 	bts, _ := json.MarshalIndent(asset, "", "  ")
 	t.Log(string(bts))
 }
+
+func TestCheapestWithdrawalFee(t *testing.T) {
+	eth, usdt, unknown := newUUID(), newUUID(), newUUID()
+	fees := []*SafeWithdrawalFee{
+		{AssetID: unknown, Amount: decimal.NewFromInt(1)},
+		{AssetID: eth, Amount: decimal.RequireFromString("0.001")},
+		{AssetID: usdt, Amount: decimal.NewFromInt(2)},
+	}
+
+	fee, err := CheapestWithdrawalFee(fees, []*SafeAsset{
+		{AssetID: eth, PriceUSD: decimal.NewFromInt(3000)},
+		{AssetID: usdt, PriceUSD: decimal.NewFromInt(1)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, usdt, fee.AssetID)
+
+	fee, err = CheapestWithdrawalFee(fees, nil)
+	require.NoError(t, err)
+	assert.Equal(t, unknown, fee.AssetID, "first option if no price")
+
+	_, err = CheapestWithdrawalFee(nil, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,161 @@
+package mixin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fox-one/mixin-sdk-go/v2/mixinnet"
+	"github.com/shopspring/decimal"
+)
+
+// SafeBalance is the balance of an asset owned by the members
+type SafeBalance struct {
+	AssetID       string
+	KernelAssetID mixinnet.Hash
+	// Amount & Count of the unspent utxos
+	Amount decimal.Decimal
+	Count  int
+	// Locked & LockedCount of the utxos signed but not spent yet
+	Locked      decimal.Decimal
+	LockedCount int
+
+	// the fields below are set by WithFiatValuation
+	Asset    *SafeAsset
+	ValueUSD decimal.Decimal
+	// Value is the value of Amount in the fiat currency
+	Value decimal.Decimal
+}
+
+type safeBalanceOptions struct {
+	fiat string
+}
+
+type SafeBalanceOption func(opts *safeBalanceOptions)
+
+// WithFiatValuation values the balances in the fiat currency, USD for example,
+// by the asset prices and the fiat rates
+func WithFiatValuation(fiat string) SafeBalanceOption {
+	return func(opts *safeBalanceOptions) {
+		opts.fiat = strings.ToUpper(fiat)
+	}
+}
+
+// SafeBalances sums the utxos of the members per asset, members is the client itself if empty
+func (c *Client) SafeBalances(ctx context.Context, members []string, threshold uint8, opts ...SafeBalanceOption) ([]*SafeBalance, error) {
+	var o safeBalanceOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	balances := make(map[string]*SafeBalance)
+	for _, state := range []SafeUtxoState{SafeUtxoStateUnspent, SafeUtxoStateSigned} {
+		if err := c.safeWalkUtxos(ctx, SafeListUtxoOption{
+			Members:   members,
+			Threshold: threshold,
+			State:     state,
+		}, func(utxos []*SafeUtxo) error {
+			addSafeBalances(balances, utxos)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	results := sortedSafeBalances(balances)
+	if o.fiat == "" || len(results) == 0 {
+		return results, nil
+	}
+
+	assetIDs := make([]string, len(results))
+	for i, b := range results {
+		assetIDs[i] = b.AssetID
+	}
+
+	assets, err := c.SafeFetchAssets(ctx, assetIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	rate := decimal.NewFromInt(1)
+	if o.fiat != "USD" {
+		fiats, err := c.ReadFiats(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if rate, err = findFiatRate(fiats, o.fiat); err != nil {
+			return nil, err
+		}
+	}
+
+	valueSafeBalances(results, assets, rate)
+	return results, nil
+}
+
+func addSafeBalances(balances map[string]*SafeBalance, utxos []*SafeUtxo) {
+	for _, utxo := range utxos {
+		b, ok := balances[utxo.AssetID]
+		if !ok {
+			b = &SafeBalance{
+				AssetID:       utxo.AssetID,
+				KernelAssetID: utxo.KernelAssetID,
+			}
+			balances[utxo.AssetID] = b
+		}
+
+		switch utxo.State {
+		case SafeUtxoStateUnspent:
+			b.Amount = b.Amount.Add(utxo.Amount)
+			b.Count++
+		case SafeUtxoStateSigned:
+			b.Locked = b.Locked.Add(utxo.Amount)
+			b.LockedCount++
+		}
+	}
+}
+
+func sortedSafeBalances(balances map[string]*SafeBalance) []*SafeBalance {
+	results := make([]*SafeBalance, 0, len(balances))
+	for _, b := range balances {
+		results = append(results, b)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].AssetID < results[j].AssetID
+	})
+
+	return results
+}
+
+func findFiatRate(fiats []Fiat, code string) (decimal.Decimal, error) {
+	for _, fiat := range fiats {
+		if strings.EqualFold(fiat.Code, code) {
+			return fiat.Rate, nil
+		}
+	}
+
+	return decimal.Zero, fmt.Errorf("fiat %s not found", code)
+}
+
+// valueSafeBalances values the balances by the usd price of the assets and
+// the rate of the fiat to usd, the results are sorted by value desc
+func valueSafeBalances(balances []*SafeBalance, assets []*SafeAsset, rate decimal.Decimal) {
+	index := make(map[string]*SafeAsset, len(assets))
+	for _, asset := range assets {
+		index[asset.AssetID] = asset
+	}
+
+	for _, b := range balances {
+		if asset, ok := index[b.AssetID]; ok {
+			b.Asset = asset
+			b.ValueUSD = b.Amount.Mul(asset.PriceUSD)
+			b.Value = b.ValueUSD.Mul(rate)
+		}
+	}
+
+	sort.SliceStable(balances, func(i, j int) bool {
+		return balances[i].ValueUSD.GreaterThan(balances[j].ValueUSD)
+	})
+}
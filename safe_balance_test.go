@@ -0,0 +1,43 @@
+package mixin
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSafeBalances(t *testing.T) {
+	btc, eth := newTestUtxos(1, 2, 3), newTestUtxos(10, 20)
+	btc[2].State = SafeUtxoStateSigned
+
+	balances := make(map[string]*SafeBalance)
+	addSafeBalances(balances, btc)
+	addSafeBalances(balances, eth)
+
+	results := sortedSafeBalances(balances)
+	require.Len(t, results, 2)
+
+	b := balances[btc[0].AssetID]
+	assert.Equal(t, "3", b.Amount.String())
+	assert.Equal(t, 2, b.Count)
+	assert.Equal(t, "3", b.Locked.String())
+	assert.Equal(t, 1, b.LockedCount)
+
+	rate, err := findFiatRate([]Fiat{{Code: "USD", Rate: decimal.NewFromInt(1)}, {Code: "CNY", Rate: decimal.NewFromInt(7)}}, "cny")
+	require.NoError(t, err)
+
+	valueSafeBalances(results, []*SafeAsset{
+		{AssetID: btc[0].AssetID, PriceUSD: decimal.NewFromInt(100)},
+		{AssetID: eth[0].AssetID, PriceUSD: decimal.NewFromInt(1)},
+	}, rate)
+
+	assert.Equal(t, btc[0].AssetID, results[0].AssetID, "sorted by value")
+	assert.Equal(t, "300", results[0].ValueUSD.String())
+	assert.Equal(t, "2100", results[0].Value.String())
+	assert.Equal(t, "30", results[1].ValueUSD.String())
+
+	_, err = findFiatRate(nil, "EUR")
+	assert.Error(t, err)
+}
@@ -0,0 +1,235 @@
+package mixin
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fox-one/mixin-sdk-go/v2/mixinnet"
+	"github.com/shopspring/decimal"
+)
+
+const safeBundleVersion = 1
+
+// SafeBundleInput is the metadata of an utxo spent by the bundle
+type SafeBundleInput struct {
+	OutputID           string          `json:"output_id"`
+	TransactionHash    mixinnet.Hash   `json:"transaction_hash"`
+	OutputIndex        uint8           `json:"output_index"`
+	AssetID            string          `json:"asset_id"`
+	Amount             decimal.Decimal `json:"amount"`
+	Receivers          []string        `json:"receivers,omitempty"`
+	ReceiversThreshold uint8           `json:"receivers_threshold,omitempty"`
+}
+
+// SafeTransactionBundle carries an unsigned safe transaction to the offline signer and back,
+// like PSBT. It is prepared online by SafePrepareBundle, signed offline by SignBundle and
+// submitted online by SafeSubmitBundle.
+type SafeTransactionBundle struct {
+	Version        int                `json:"version"`
+	RequestID      string             `json:"request_id"`
+	RawTransaction string             `json:"raw_transaction"`
+	Views          []mixinnet.Key     `json:"views"`
+	Inputs         []*SafeBundleInput `json:"inputs,omitempty"`
+	// SignerIndex is the index of the signer in the sorted senders, 0 for single signer
+	SignerIndex uint16 `json:"signer_index"`
+	// Summary is the human-readable description of the raw transaction, see SummarizeSafeTransaction
+	Summary string `json:"summary"`
+	Signed  bool   `json:"signed,omitempty"`
+}
+
+// NewSafeBundle builds the bundle from the transaction request created
+// by SafeCreateTransactionRequest and the utxos spent by it
+func NewSafeBundle(request *SafeTransactionRequest, utxos []*SafeUtxo) (*SafeTransactionBundle, error) {
+	bundle := &SafeTransactionBundle{
+		Version:        safeBundleVersion,
+		RequestID:      request.RequestID,
+		RawTransaction: request.RawTransaction,
+		Views:          request.Views,
+	}
+
+	tx, err := mixinnet.TransactionFromRaw(request.RawTransaction)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle.Summary = SummarizeSafeTransaction(tx)
+
+	for _, utxo := range utxos {
+		bundle.Inputs = append(bundle.Inputs, &SafeBundleInput{
+			OutputID:           utxo.OutputID,
+			TransactionHash:    utxo.TransactionHash,
+			OutputIndex:        utxo.OutputIndex,
+			AssetID:            utxo.AssetID,
+			Amount:             utxo.Amount,
+			Receivers:          utxo.Receivers,
+			ReceiversThreshold: utxo.ReceiversThreshold,
+		})
+	}
+
+	if err := bundle.Verify(); err != nil {
+		return nil, err
+	}
+
+	return bundle, nil
+}
+
+// SummarizeSafeTransaction describes the asset, the outputs and the extra of the transaction,
+// the summary of a bundle is derived from its raw transaction so it can't lie about what is signed
+func SummarizeSafeTransaction(tx *mixinnet.Transaction) string {
+	lines := []string{fmt.Sprintf("asset %s", tx.Asset)}
+	for idx, output := range tx.Outputs {
+		switch {
+		case output.Type == mixinnet.OutputTypeWithdrawalSubmit && output.Withdrawal != nil:
+			line := fmt.Sprintf("output %d: withdraw %s to %s", idx, output.Amount, output.Withdrawal.Address)
+			if output.Withdrawal.Tag != "" {
+				line += fmt.Sprintf(" tag %s", output.Withdrawal.Tag)
+			}
+			lines = append(lines, line)
+		case output.Type == mixinnet.OutputTypeScript:
+			line := fmt.Sprintf("output %d: send %s to %d keys", idx, output.Amount, len(output.Keys))
+			if len(output.Script) == 3 {
+				line += fmt.Sprintf(" with threshold %d", output.Script[2])
+			}
+			lines = append(lines, line)
+		default:
+			lines = append(lines, fmt.Sprintf("output %d: type 0x%x amount %s", idx, output.Type, output.Amount))
+		}
+	}
+
+	if len(tx.Extra) > 0 {
+		lines = append(lines, fmt.Sprintf("extra %q", string(tx.Extra)))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// SafePrepareBundle creates the transaction request of the unsigned transaction
+// built from the utxos, and returns the bundle to be signed offline
+func (c *Client) SafePrepareBundle(ctx context.Context, requestID string, tx *mixinnet.Transaction, utxos []*SafeUtxo) (*SafeTransactionBundle, error) {
+	raw, err := tx.Dump()
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := c.SafeCreateTransactionRequest(ctx, &SafeTransactionRequestInput{
+		RequestID:      requestID,
+		RawTransaction: raw,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return NewSafeBundle(request, utxos)
+}
+
+// Verify checks the raw transaction matches the summary, the views and the inputs of the bundle
+func (b *SafeTransactionBundle) Verify() error {
+	if b.Version != safeBundleVersion {
+		return fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+
+	tx, err := mixinnet.TransactionFromRaw(b.RawTransaction)
+	if err != nil {
+		return err
+	}
+
+	if summary := SummarizeSafeTransaction(tx); b.Summary != summary {
+		return fmt.Errorf("summary not matched with the transaction: %s", summary)
+	}
+
+	if len(b.Views) != len(tx.Inputs) {
+		return fmt.Errorf("views count %d not matched with inputs %d", len(b.Views), len(tx.Inputs))
+	}
+
+	if len(b.Inputs) == 0 {
+		return nil
+	}
+
+	if len(b.Inputs) != len(tx.Inputs) {
+		return fmt.Errorf("inputs count %d not matched with the transaction %d", len(b.Inputs), len(tx.Inputs))
+	}
+
+	for idx, input := range tx.Inputs {
+		meta := b.Inputs[idx]
+		if input.Hash == nil || *input.Hash != meta.TransactionHash || input.Index != meta.OutputIndex {
+			return fmt.Errorf("input %d not matched with %s", idx, meta.OutputID)
+		}
+	}
+
+	return nil
+}
+
+// Encode returns the bundle as a base64 string, easy to copy or to show as qr code
+func (b *SafeTransactionBundle) Encode() (string, error) {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeSafeBundle decodes and verifies the bundle encoded by Encode
+func DecodeSafeBundle(s string) (*SafeTransactionBundle, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+
+	var b SafeTransactionBundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, err
+	}
+
+	if err := b.Verify(); err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+// SignBundle signs the transaction of the bundle with the spend key, it works offline.
+// The bundle is rejected if its summary doesn't describe the raw transaction
+func SignBundle(b *SafeTransactionBundle, spendKey mixinnet.Key) error {
+	if err := b.Verify(); err != nil {
+		return err
+	}
+
+	tx, err := mixinnet.TransactionFromRaw(b.RawTransaction)
+	if err != nil {
+		return err
+	}
+
+	if err := SafeSignTransaction(tx, spendKey, b.Views, b.SignerIndex); err != nil {
+		return err
+	}
+
+	raw, err := tx.Dump()
+	if err != nil {
+		return err
+	}
+
+	b.RawTransaction = raw
+	b.Signed = true
+	return nil
+}
+
+// SafeSubmitBundle submits the transaction signed by SignBundle
+func (c *Client) SafeSubmitBundle(ctx context.Context, b *SafeTransactionBundle) (*SafeTransactionRequest, error) {
+	if !b.Signed {
+		return nil, errors.New("bundle not signed")
+	}
+
+	if err := b.Verify(); err != nil {
+		return nil, err
+	}
+
+	return c.SafeSubmitTransactionRequest(ctx, &SafeTransactionRequestInput{
+		RequestID:      b.RequestID,
+		RawTransaction: b.RawTransaction,
+	})
+}
@@ -0,0 +1,85 @@
+package mixin
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/fox-one/mixin-sdk-go/v2/mixinnet"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSafeBundle(t *testing.T) {
+	kernelAssetID := mixinnet.NewHash([]byte(newUUID()))
+	utxos := newTestUtxos(3, 2)
+	for i, utxo := range utxos {
+		utxo.TransactionHash = mixinnet.NewHash([]byte(utxo.OutputID))
+		utxo.OutputIndex = uint8(i)
+		utxo.KernelAssetID = kernelAssetID
+		utxo.Receivers = []string{"e9e5b807-fa8b-455a-8dfa-b189d28310ff"}
+		utxo.ReceiversThreshold = 1
+	}
+
+	b := NewSafeTransactionBuilder(utxos)
+	b.Outputs = append(b.Outputs, newWithdrawalOutput("0x1234", "", decimal.NewFromInt(5)))
+	tx, err := b.Build()
+	require.NoError(t, err)
+
+	raw, err := tx.Dump()
+	require.NoError(t, err)
+	txHash, err := tx.TransactionHash()
+	require.NoError(t, err)
+
+	views := []mixinnet.Key{mixinnet.GenerateKey(rand.Reader), mixinnet.GenerateKey(rand.Reader)}
+	bundle, err := NewSafeBundle(&SafeTransactionRequest{
+		RequestID:      newUUID(),
+		AssetID:        kernelAssetID,
+		Amount:         decimal.NewFromInt(5),
+		RawTransaction: raw,
+		Views:          views,
+	}, utxos)
+	require.NoError(t, err)
+	assert.Len(t, bundle.Inputs, 2)
+	assert.Equal(t, "asset "+kernelAssetID.String()+"\noutput 0: withdraw 5.00000000 to 0x1234", bundle.Summary)
+
+	s, err := bundle.Encode()
+	require.NoError(t, err)
+
+	decoded, err := DecodeSafeBundle(s)
+	require.NoError(t, err)
+	assert.Equal(t, bundle, decoded)
+
+	_, err = NewSafeBundle(&SafeTransactionRequest{RawTransaction: raw, Views: views[:1]}, utxos)
+	assert.Error(t, err, "views not matched")
+
+	_, err = NewSafeBundle(&SafeTransactionRequest{RawTransaction: raw, Views: views}, utxos[:1])
+	assert.Error(t, err, "inputs not matched")
+
+	spendKey := mixinnet.GenerateKey(rand.Reader)
+
+	tampered := *decoded
+	tampered.Summary = "asset " + kernelAssetID.String() + "\noutput 0: withdraw 5.00000000 to 0xabcd"
+	assert.Error(t, SignBundle(&tampered, spendKey), "summary not matched")
+
+	b.Outputs[0].Withdrawal.Address = "0xabcd"
+	evil, err := b.Build()
+	require.NoError(t, err)
+	tampered = *decoded
+	tampered.RawTransaction, err = evil.Dump()
+	require.NoError(t, err)
+	assert.Error(t, SignBundle(&tampered, spendKey), "output tampered")
+	assert.False(t, tampered.Signed)
+
+	require.NoError(t, SignBundle(decoded, spendKey))
+	assert.True(t, decoded.Signed)
+
+	signed, err := mixinnet.TransactionFromRaw(decoded.RawTransaction)
+	require.NoError(t, err)
+	require.Len(t, signed.Signatures, 2)
+	assert.NotNil(t, signed.Signatures[1][0])
+
+	hash, err := signed.TransactionHash()
+	require.NoError(t, err)
+	assert.Equal(t, txHash, hash)
+}
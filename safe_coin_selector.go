@@ -0,0 +1,324 @@
+package mixin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/fox-one/mixin-sdk-go/v2/mixinnet"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// maxSafeTransactionInputs is the max inputs of a safe transaction
+	maxSafeTransactionInputs = mixinnet.SliceCountLimit
+
+	safeListUtxosPageSize = 500
+
+	// branchAndBoundMaxTries bounds the search of the exact match
+	branchAndBoundMaxTries = 100000
+)
+
+// InsufficientBalanceError is returned if the unspent utxos, limited by the max inputs
+// of a transaction, are not enough to pay the amount
+type InsufficientBalanceError struct {
+	AssetID   string
+	Amount    decimal.Decimal
+	Available decimal.Decimal
+	Shortfall decimal.Decimal
+}
+
+func (e *InsufficientBalanceError) Error() string {
+	return fmt.Sprintf("insufficient balance of %s: amount %s, available %s, shortfall %s", e.AssetID, e.Amount, e.Available, e.Shortfall)
+}
+
+// CoinSelectStrategy selects utxos with total amount >= amount and at most maxInputs utxos,
+// nil is returned if it is impossible
+type CoinSelectStrategy func(utxos []*SafeUtxo, amount decimal.Decimal, maxInputs int) []*SafeUtxo
+
+// CoinSelection is the result of selecting utxos, Change returns to the sender
+type CoinSelection struct {
+	Inputs []*SafeUtxo
+	Total  decimal.Decimal
+	Change decimal.Decimal
+}
+
+func sortedUtxos(utxos []*SafeUtxo, less func(a, b *SafeUtxo) bool) []*SafeUtxo {
+	sorted := make([]*SafeUtxo, len(utxos))
+	copy(sorted, utxos)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return less(sorted[i], sorted[j])
+	})
+
+	return sorted
+}
+
+// accumulate takes utxos in order until the amount is reached, if more than maxInputs
+// are needed, the window of maxInputs utxos slides forward to larger ones
+func accumulate(sorted []*SafeUtxo, amount decimal.Decimal, maxInputs int) []*SafeUtxo {
+	var (
+		start int
+		total decimal.Decimal
+	)
+
+	for end, utxo := range sorted {
+		total = total.Add(utxo.Amount)
+		if end-start+1 > maxInputs {
+			total = total.Sub(sorted[start].Amount)
+			start++
+		}
+
+		if total.GreaterThanOrEqual(amount) {
+			return sorted[start : end+1]
+		}
+	}
+
+	return nil
+}
+
+// CoinSelectLargestFirst uses the fewest utxos
+func CoinSelectLargestFirst(utxos []*SafeUtxo, amount decimal.Decimal, maxInputs int) []*SafeUtxo {
+	sorted := sortedUtxos(utxos, func(a, b *SafeUtxo) bool {
+		return a.Amount.GreaterThan(b.Amount)
+	})
+
+	return accumulate(sorted, amount, maxInputs)
+}
+
+// CoinSelectSmallestFirst spends the dust first, if the dust is too many
+// to fit in one transaction, the smallest utxos are skipped
+func CoinSelectSmallestFirst(utxos []*SafeUtxo, amount decimal.Decimal, maxInputs int) []*SafeUtxo {
+	sorted := sortedUtxos(utxos, func(a, b *SafeUtxo) bool {
+		return a.Amount.LessThan(b.Amount)
+	})
+
+	return accumulate(sorted, amount, maxInputs)
+}
+
+// CoinSelectOldestFirst spends utxos in the order they were created,
+// it falls back to largest first if too many utxos are needed
+func CoinSelectOldestFirst(utxos []*SafeUtxo, amount decimal.Decimal, maxInputs int) []*SafeUtxo {
+	sorted := sortedUtxos(utxos, func(a, b *SafeUtxo) bool {
+		return a.Sequence < b.Sequence
+	})
+
+	var total decimal.Decimal
+	for idx, utxo := range sorted {
+		if idx >= maxInputs {
+			break
+		}
+
+		if total = total.Add(utxo.Amount); total.GreaterThanOrEqual(amount) {
+			return sorted[:idx+1]
+		}
+	}
+
+	return CoinSelectLargestFirst(utxos, amount, maxInputs)
+}
+
+// CoinSelectBranchAndBound searches utxos matching the amount exactly so no change
+// output is needed, it falls back to largest first if no exact match is found
+func CoinSelectBranchAndBound(utxos []*SafeUtxo, amount decimal.Decimal, maxInputs int) []*SafeUtxo {
+	sorted := sortedUtxos(utxos, func(a, b *SafeUtxo) bool {
+		return a.Amount.GreaterThan(b.Amount)
+	})
+
+	// remains[i] is the sum of sorted[i:]
+	remains := make([]decimal.Decimal, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remains[i] = remains[i+1].Add(sorted[i].Amount)
+	}
+
+	var (
+		tries    int
+		selected []*SafeUtxo
+		search   func(idx int, total decimal.Decimal) bool
+	)
+
+	search = func(idx int, total decimal.Decimal) bool {
+		if total.Equal(amount) {
+			return true
+		}
+
+		tries++
+		if idx >= len(sorted) || len(selected) >= maxInputs || tries > branchAndBoundMaxTries {
+			return false
+		}
+
+		// bound: exceeded or unreachable
+		if total.GreaterThan(amount) || total.Add(remains[idx]).LessThan(amount) {
+			return false
+		}
+
+		selected = append(selected, sorted[idx])
+		if search(idx+1, total.Add(sorted[idx].Amount)) {
+			return true
+		}
+
+		selected = selected[:len(selected)-1]
+		return search(idx+1, total)
+	}
+
+	if amount.IsPositive() && search(0, decimal.Zero) {
+		return selected
+	}
+
+	return CoinSelectLargestFirst(utxos, amount, maxInputs)
+}
+
+// SelectCoins selects unspent utxos paying the amount by the strategy, default is largest first.
+// The utxos must be of the same asset and receivers, signed & spent ones are skipped.
+func SelectCoins(utxos []*SafeUtxo, amount decimal.Decimal, strategy CoinSelectStrategy) (*CoinSelection, error) {
+	return selectCoins(utxos, amount, strategy, maxSafeTransactionInputs)
+}
+
+func selectCoins(utxos []*SafeUtxo, amount decimal.Decimal, strategy CoinSelectStrategy, maxInputs int) (*CoinSelection, error) {
+	if !amount.IsPositive() {
+		return nil, fmt.Errorf("invalid amount %s", amount)
+	}
+
+	if strategy == nil {
+		strategy = CoinSelectLargestFirst
+	}
+
+	if maxInputs <= 0 || maxInputs > maxSafeTransactionInputs {
+		maxInputs = maxSafeTransactionInputs
+	}
+
+	var (
+		candidates []*SafeUtxo
+		assetID    string
+	)
+
+	for _, utxo := range utxos {
+		if utxo.State != "" && utxo.State != SafeUtxoStateUnspent {
+			continue
+		}
+
+		if len(candidates) > 0 {
+			first := candidates[0]
+			if utxo.AssetID != first.AssetID {
+				return nil, fmt.Errorf("utxo %s: asset mismatch", utxo.OutputID)
+			}
+
+			if utxo.ReceiversHash != first.ReceiversHash || utxo.ReceiversThreshold != first.ReceiversThreshold {
+				return nil, fmt.Errorf("utxo %s: receivers mismatch", utxo.OutputID)
+			}
+		}
+
+		assetID = utxo.AssetID
+		candidates = append(candidates, utxo)
+	}
+
+	inputs := strategy(candidates, amount, maxInputs)
+	if len(inputs) == 0 {
+		// the max amount could be spent in one transaction
+		available := decimal.Zero
+		largest := sortedUtxos(candidates, func(a, b *SafeUtxo) bool {
+			return a.Amount.GreaterThan(b.Amount)
+		})
+
+		for idx, utxo := range largest {
+			if idx >= maxInputs {
+				break
+			}
+
+			available = available.Add(utxo.Amount)
+		}
+
+		return nil, &InsufficientBalanceError{
+			AssetID:   assetID,
+			Amount:    amount,
+			Available: available,
+			Shortfall: amount.Sub(available),
+		}
+	}
+
+	selection := &CoinSelection{Inputs: inputs}
+	for _, utxo := range inputs {
+		selection.Total = selection.Total.Add(utxo.Amount)
+	}
+
+	selection.Change = selection.Total.Sub(amount)
+	return selection, nil
+}
+
+// SafeListAllUtxos pages through SafeListUtxos in ascending sequence order,
+// starting from opt.Offset, and returns all the utxos
+func (c *Client) SafeListAllUtxos(ctx context.Context, opt SafeListUtxoOption) ([]*SafeUtxo, error) {
+	var all []*SafeUtxo
+	err := c.safeWalkUtxos(ctx, opt, func(utxos []*SafeUtxo) error {
+		all = append(all, utxos...)
+		return nil
+	})
+
+	return all, err
+}
+
+// safeWalkUtxos calls fn with every page of utxos in ascending sequence order
+func (c *Client) safeWalkUtxos(ctx context.Context, opt SafeListUtxoOption, fn func(utxos []*SafeUtxo) error) error {
+	return walkSafeUtxos(ctx, c.SafeListUtxos, opt, fn)
+}
+
+func walkSafeUtxos(
+	ctx context.Context,
+	list func(ctx context.Context, opt SafeListUtxoOption) ([]*SafeUtxo, error),
+	opt SafeListUtxoOption,
+	fn func(utxos []*SafeUtxo) error,
+) error {
+	opt.Order = "ASC"
+	if opt.Limit <= 0 {
+		opt.Limit = safeListUtxosPageSize
+	}
+
+	for {
+		utxos, err := list(ctx, opt)
+		if err != nil {
+			return err
+		}
+
+		if len(utxos) > 0 {
+			if err := fn(utxos); err != nil {
+				return err
+			}
+
+			opt.Offset = utxos[len(utxos)-1].Sequence + 1
+		}
+
+		if len(utxos) < opt.Limit {
+			return nil
+		}
+	}
+}
+
+type SafeSelectUtxosInput struct {
+	AssetID string
+	Amount  decimal.Decimal
+	// Members & Threshold of the utxos, default is the client itself
+	Members   []string
+	Threshold uint8
+	// Strategy default is CoinSelectLargestFirst
+	Strategy CoinSelectStrategy
+	// MaxInputs default and max is 256
+	MaxInputs int
+}
+
+// SafeSelectUtxos lists the unspent utxos of the asset and selects the inputs paying the amount
+func (c *Client) SafeSelectUtxos(ctx context.Context, input SafeSelectUtxosInput) (*CoinSelection, error) {
+	utxos, err := c.SafeListAllUtxos(ctx, SafeListUtxoOption{
+		Members:   input.Members,
+		Threshold: input.Threshold,
+		Asset:     input.AssetID,
+		State:     SafeUtxoStateUnspent,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	selection, err := selectCoins(utxos, input.Amount, input.Strategy, input.MaxInputs)
+	if e, ok := err.(*InsufficientBalanceError); ok && e.AssetID == "" {
+		e.AssetID = input.AssetID
+	}
+
+	return selection, err
+}
@@ -0,0 +1,79 @@
+package mixin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestUtxos(amounts ...int64) []*SafeUtxo {
+	assetID := newUUID()
+	utxos := make([]*SafeUtxo, len(amounts))
+	for i, amount := range amounts {
+		utxos[i] = &SafeUtxo{
+			OutputID: newUUID(),
+			AssetID:  assetID,
+			Amount:   decimal.NewFromInt(amount),
+			State:    SafeUtxoStateUnspent,
+			Sequence: uint64(i + 1),
+		}
+	}
+
+	return utxos
+}
+
+func TestSelectCoins(t *testing.T) {
+	utxos := newTestUtxos(5, 1, 8, 3, 2)
+
+	s, err := SelectCoins(utxos, decimal.NewFromInt(9), CoinSelectLargestFirst)
+	require.NoError(t, err)
+	assert.Len(t, s.Inputs, 2)
+	assert.Equal(t, "4", s.Change.String())
+
+	s, err = SelectCoins(utxos, decimal.NewFromInt(4), CoinSelectSmallestFirst)
+	require.NoError(t, err)
+	assert.Equal(t, "6", s.Total.String(), "1 + 2 + 3")
+
+	s, err = SelectCoins(utxos, decimal.NewFromInt(6), CoinSelectOldestFirst)
+	require.NoError(t, err)
+	assert.Equal(t, utxos[:2], s.Inputs)
+
+	s, err = SelectCoins(utxos, decimal.NewFromInt(12), CoinSelectBranchAndBound)
+	require.NoError(t, err)
+	assert.True(t, s.Change.IsZero(), "exact match")
+	assert.Equal(t, "12", sumSafeUtxos(s.Inputs).String())
+
+	utxos[2].State = SafeUtxoStateSigned
+	_, err = SelectCoins(utxos, decimal.NewFromInt(12), nil)
+	var e *InsufficientBalanceError
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, "11", e.Available.String())
+	assert.Equal(t, "1", e.Shortfall.String())
+	assert.Equal(t, utxos[0].AssetID, e.AssetID)
+
+	mixed := append(newTestUtxos(1), newTestUtxos(1)...)
+	_, err = SelectCoins(mixed, decimal.NewFromInt(2), nil)
+	assert.Error(t, err, "asset mismatch")
+}
+
+func TestSelectCoinsMaxInputs(t *testing.T) {
+	amounts := make([]int64, 10)
+	for i := range amounts {
+		amounts[i] = int64(i + 1)
+	}
+	utxos := newTestUtxos(amounts...)
+
+	// smallest first slides to larger utxos when the dust doesn't fit
+	s, err := selectCoins(utxos, decimal.NewFromInt(15), CoinSelectSmallestFirst, 3)
+	require.NoError(t, err)
+	assert.Len(t, s.Inputs, 3)
+	assert.True(t, s.Total.GreaterThanOrEqual(decimal.NewFromInt(15)))
+
+	_, err = selectCoins(utxos, decimal.NewFromInt(28), CoinSelectOldestFirst, 3)
+	var e *InsufficientBalanceError
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, "27", e.Available.String(), "10 + 9 + 8")
+}
@@ -0,0 +1,221 @@
+package mixin
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fox-one/mixin-sdk-go/v2/mixinnet"
+	"github.com/shopspring/decimal"
+)
+
+type SafeConsolidateConfig struct {
+	// Assets limits the assets to consolidate, all assets if empty
+	Assets []string
+	// MinUtxos is the count of unspent utxos of an asset to trigger the consolidation, default is 64
+	MinUtxos int
+	// MaxInputs of every consolidation transaction, default and max is 256
+	MaxInputs int
+	// MaxTransactions limits the transactions submitted in one run, unlimited if zero
+	MaxTransactions int
+	// Interval between two transactions, default is 1 second
+	Interval time.Duration
+	// DryRun reports the consolidations without submitting them
+	DryRun bool
+	// Memo of the consolidation transactions
+	Memo string
+}
+
+type SafeConsolidation struct {
+	AssetID   string
+	RequestID string
+	Inputs    int
+	Amount    decimal.Decimal
+	// Request is the submitted transaction request, nil in dry run
+	Request *SafeTransactionRequest
+}
+
+type SafeConsolidateReport struct {
+	// Utxos is the count of unspent utxos per asset before consolidating
+	Utxos          map[string]int
+	Consolidations []*SafeConsolidation
+}
+
+func (cfg *SafeConsolidateConfig) normalize() {
+	if cfg.MinUtxos <= 1 {
+		cfg.MinUtxos = 64
+	}
+
+	if cfg.MaxInputs <= 1 || cfg.MaxInputs > maxSafeTransactionInputs {
+		cfg.MaxInputs = maxSafeTransactionInputs
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+}
+
+// planSafeConsolidations splits the utxos of one asset into chunks merged by one transaction
+// each, the smallest utxos go first. It stops once the count drops below minUtxos.
+func planSafeConsolidations(utxos []*SafeUtxo, minUtxos, maxInputs int) [][]*SafeUtxo {
+	sorted := sortedUtxos(utxos, func(a, b *SafeUtxo) bool {
+		return a.Amount.LessThan(b.Amount)
+	})
+
+	var (
+		chunks [][]*SafeUtxo
+		count  = len(sorted)
+	)
+
+	for len(sorted) > 1 && count >= minUtxos {
+		n := maxInputs
+		if n > len(sorted) {
+			n = len(sorted)
+		}
+
+		chunks = append(chunks, sorted[:n])
+		sorted = sorted[n:]
+		// n inputs merged into one output
+		count -= n - 1
+	}
+
+	return chunks
+}
+
+// consolidationRequestID derives the request id from the inputs, so retrying the same chunk is idempotent
+func consolidationRequestID(utxos []*SafeUtxo) string {
+	ids := make([]string, len(utxos))
+	for i, utxo := range utxos {
+		ids[i] = utxo.OutputID
+	}
+
+	sort.Strings(ids)
+	return uuidHash([]byte("consolidate:" + strings.Join(ids, ",")))
+}
+
+// SafeConsolidateUtxos merges the unspent utxos of the client, for assets having
+// at least MinUtxos utxos, into fewer utxos by transferring them to itself
+func (c *Client) SafeConsolidateUtxos(ctx context.Context, cfg SafeConsolidateConfig, spendKey mixinnet.Key) (*SafeConsolidateReport, error) {
+	cfg.normalize()
+
+	assets := make(map[string]bool, len(cfg.Assets))
+	for _, id := range cfg.Assets {
+		assets[id] = true
+	}
+
+	groups := make(map[string][]*SafeUtxo)
+	if err := c.safeWalkUtxos(ctx, SafeListUtxoOption{State: SafeUtxoStateUnspent}, func(utxos []*SafeUtxo) error {
+		for _, utxo := range utxos {
+			if len(assets) == 0 || assets[utxo.AssetID] {
+				groups[utxo.AssetID] = append(groups[utxo.AssetID], utxo)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	report := &SafeConsolidateReport{Utxos: make(map[string]int, len(groups))}
+	assetIDs := make([]string, 0, len(groups))
+	for id, utxos := range groups {
+		report.Utxos[id] = len(utxos)
+		assetIDs = append(assetIDs, id)
+	}
+
+	sort.Strings(assetIDs)
+
+	addr, err := NewMixAddress([]string{c.ClientID}, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, assetID := range assetIDs {
+		for _, chunk := range planSafeConsolidations(groups[assetID], cfg.MinUtxos, cfg.MaxInputs) {
+			if cfg.MaxTransactions > 0 && len(report.Consolidations) >= cfg.MaxTransactions {
+				return report, nil
+			}
+
+			consolidation := &SafeConsolidation{
+				AssetID:   assetID,
+				RequestID: consolidationRequestID(chunk),
+				Inputs:    len(chunk),
+				Amount:    sumSafeUtxos(chunk),
+			}
+
+			if !cfg.DryRun {
+				// rate limit
+				if len(report.Consolidations) > 0 {
+					if err := sleepContext(ctx, cfg.Interval); err != nil {
+						return report, err
+					}
+				}
+
+				if consolidation.Request, err = c.safeConsolidate(ctx, consolidation, chunk, addr, cfg.Memo, spendKey); err != nil {
+					return report, err
+				}
+			}
+
+			report.Consolidations = append(report.Consolidations, consolidation)
+		}
+	}
+
+	return report, nil
+}
+
+func sumSafeUtxos(utxos []*SafeUtxo) decimal.Decimal {
+	var total decimal.Decimal
+	for _, utxo := range utxos {
+		total = total.Add(utxo.Amount)
+	}
+
+	return total
+}
+
+func (c *Client) safeConsolidate(ctx context.Context, consolidation *SafeConsolidation, utxos []*SafeUtxo, addr *MixAddress, memo string, spendKey mixinnet.Key) (*SafeTransactionRequest, error) {
+	if request, err := c.safeReadTransactionRequest(ctx, consolidation.RequestID); err != nil {
+		return nil, err
+	} else if request != nil {
+		return c.safeSignAndSubmit(ctx, request, spendKey)
+	}
+
+	b := NewSafeTransactionBuilder(utxos)
+	b.Memo = memo
+	b.Hint = consolidation.RequestID
+
+	tx, err := c.MakeTransaction(ctx, b, []*TransactionOutput{
+		{
+			Address: addr,
+			Amount:  consolidation.Amount,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.safeCreateSignAndSubmit(ctx, consolidation.RequestID, tx, spendKey)
+}
+
+// RunSafeConsolidation runs SafeConsolidateUtxos every period until ctx is done,
+// onReport is called after every run with its report or error
+func (c *Client) RunSafeConsolidation(ctx context.Context, cfg SafeConsolidateConfig, spendKey mixinnet.Key, period time.Duration, onReport func(report *SafeConsolidateReport, err error)) error {
+	if period <= 0 {
+		period = time.Hour
+	}
+
+	for {
+		report, err := c.SafeConsolidateUtxos(ctx, cfg, spendKey)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if onReport != nil {
+			onReport(report, err)
+		}
+
+		if err := sleepContext(ctx, period); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package mixin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanSafeConsolidations(t *testing.T) {
+	amounts := make([]int64, 600)
+	for i := range amounts {
+		amounts[i] = int64(len(amounts) - i)
+	}
+	utxos := newTestUtxos(amounts...)
+
+	chunks := planSafeConsolidations(utxos, 64, maxSafeTransactionInputs)
+	// 600 -> 345 -> 90 -> 1
+	if assert.Len(t, chunks, 3) {
+		assert.Len(t, chunks[0], 256)
+		assert.Len(t, chunks[2], 88)
+		assert.Equal(t, "1", chunks[0][0].Amount.String(), "smallest first")
+	}
+
+	assert.Empty(t, planSafeConsolidations(utxos[:63], 64, maxSafeTransactionInputs))
+
+	chunks = planSafeConsolidations(utxos[:10], 5, 4)
+	// 10 -> 7 -> 4
+	assert.Len(t, chunks, 2)
+
+	assert.Equal(t, consolidationRequestID(chunks[0]), consolidationRequestID([]*SafeUtxo{chunks[0][3], chunks[0][2], chunks[0][1], chunks[0][0]}))
+	assert.NotEqual(t, consolidationRequestID(chunks[0]), consolidationRequestID(chunks[1]))
+}
@@ -0,0 +1,153 @@
+package mixin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/fox-one/mixin-sdk-go/v2/mixinnet"
+)
+
+// SafeMultisigSignerIndex returns the signing index of the member, which is
+// its position in the sorted senders
+func SafeMultisigSignerIndex(senders []string, member string) (uint16, error) {
+	sorted := slices.Clone(senders)
+	slices.Sort(sorted)
+
+	idx := slices.Index(sorted, member)
+	if idx < 0 {
+		return 0, fmt.Errorf("%s is not a sender", member)
+	}
+
+	return uint16(idx), nil
+}
+
+// SignerIndex returns the signing index of the member in the senders of the request
+func (r *SafeMultisigRequest) SignerIndex(member string) (uint16, error) {
+	return SafeMultisigSignerIndex(r.Senders, member)
+}
+
+// SafeSignMultisigRaw signs the raw transaction of the request in the slot of the member,
+// signatures of other members in the raw transaction are kept
+func SafeSignMultisigRaw(request *SafeMultisigRequest, member string, spendKey mixinnet.Key) (string, error) {
+	k, err := request.SignerIndex(member)
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := mixinnet.TransactionFromRaw(request.RawTransaction)
+	if err != nil {
+		return "", err
+	}
+
+	if len(request.Views) != len(tx.Inputs) {
+		return "", fmt.Errorf("views count %d not matched with inputs %d", len(request.Views), len(tx.Inputs))
+	}
+
+	if err := SafeSignTransaction(tx, spendKey, request.Views, k); err != nil {
+		return "", err
+	}
+
+	return tx.Dump()
+}
+
+// MergeSafeSignatures merges the signatures of the raw transactions signed by different
+// members into one, the transactions must be the same except for the signatures
+func MergeSafeSignatures(raws ...string) (string, error) {
+	if len(raws) == 0 {
+		return "", errors.New("no raw transaction")
+	}
+
+	var (
+		merged *mixinnet.Transaction
+		hash   mixinnet.Hash
+	)
+
+	for _, raw := range raws {
+		tx, err := mixinnet.TransactionFromRaw(raw)
+		if err != nil {
+			return "", err
+		}
+
+		h, err := tx.TransactionHash()
+		if err != nil {
+			return "", err
+		}
+
+		if tx.Signatures != nil && len(tx.Signatures) != len(tx.Inputs) {
+			return "", fmt.Errorf("transaction %s: %d signature slots not matched with %d inputs", h, len(tx.Signatures), len(tx.Inputs))
+		}
+
+		signatures := tx.Signatures
+		if merged == nil {
+			merged, hash = tx, h
+			merged.Signatures = make([]map[uint16]*mixinnet.Signature, len(tx.Inputs))
+		} else if h != hash || len(tx.Inputs) != len(merged.Inputs) {
+			return "", fmt.Errorf("transaction %s not matched with %s", h, hash)
+		}
+
+		for idx, sigs := range signatures {
+			if merged.Signatures[idx] == nil {
+				merged.Signatures[idx] = make(map[uint16]*mixinnet.Signature, len(sigs))
+			}
+
+			for k, sig := range sigs {
+				if sig == nil {
+					continue
+				}
+
+				if exist, ok := merged.Signatures[idx][k]; ok && *exist != *sig {
+					return "", fmt.Errorf("conflicting signatures of input %d at index %d", idx, k)
+				}
+
+				merged.Signatures[idx][k] = sig
+			}
+		}
+	}
+
+	return merged.Dump()
+}
+
+// SafeSignatureCountReached reports whether every input of the raw transaction has at
+// least threshold signatures. It only counts the signatures, they are not verified
+// against the keys of the inputs, invalid signatures are rejected when submitted.
+func SafeSignatureCountReached(raw string, threshold uint8) (bool, error) {
+	tx, err := mixinnet.TransactionFromRaw(raw)
+	if err != nil {
+		return false, err
+	}
+
+	if len(tx.Signatures) != len(tx.Inputs) {
+		return false, nil
+	}
+
+	for _, sigs := range tx.Signatures {
+		var n int
+		for _, sig := range sigs {
+			if sig != nil {
+				n++
+			}
+		}
+
+		if n < int(threshold) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// SafeSubmitMultisigSignatures merges the partially signed raw transactions of the request
+// and submits them, the transaction is sent once the senders threshold is met
+func (c *Client) SafeSubmitMultisigSignatures(ctx context.Context, requestID string, raws ...string) (*SafeMultisigRequest, error) {
+	raw, err := MergeSafeSignatures(raws...)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.SafeSignMultisigRequest(ctx, &SafeTransactionRequestInput{
+		RequestID:      requestID,
+		RawTransaction: raw,
+	})
+}
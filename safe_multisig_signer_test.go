@@ -0,0 +1,104 @@
+package mixin
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/fox-one/mixin-sdk-go/v2/mixinnet"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSafeMultisigSignerIndex(t *testing.T) {
+	senders := []string{"c", "a", "b"}
+
+	k, err := SafeMultisigSignerIndex(senders, "c")
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, k)
+
+	k, err = SafeMultisigSignerIndex(senders, "a")
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, k)
+	assert.Equal(t, []string{"c", "a", "b"}, senders, "senders not sorted in place")
+
+	_, err = SafeMultisigSignerIndex(senders, "d")
+	assert.Error(t, err)
+}
+
+func TestMergeSafeSignatures(t *testing.T) {
+	members := []string{"e9e5b807-fa8b-455a-8dfa-b189d28310ff", "6a00a4bc-229e-3c39-978a-91d2d6c382bf"}
+	utxos := newTestUtxos(3, 2)
+	for i, utxo := range utxos {
+		utxo.TransactionHash = mixinnet.NewHash([]byte(utxo.OutputID))
+		utxo.OutputIndex = uint8(i)
+		utxo.KernelAssetID = mixinnet.NewHash([]byte(utxo.AssetID))
+		utxo.Receivers = members
+		utxo.ReceiversThreshold = 2
+	}
+
+	b := NewSafeTransactionBuilder(utxos)
+	b.Outputs = append(b.Outputs, newWithdrawalOutput("0x1234", "", decimal.NewFromInt(5)))
+	tx, err := b.Build()
+	require.NoError(t, err)
+
+	raw, err := tx.Dump()
+	require.NoError(t, err)
+
+	request := &SafeMultisigRequest{
+		RawTransaction:   raw,
+		Senders:          members,
+		SendersThreshold: 2,
+		Views:            []mixinnet.Key{mixinnet.GenerateKey(rand.Reader), mixinnet.GenerateKey(rand.Reader)},
+	}
+
+	signed := make([]string, len(members))
+	for i, member := range members {
+		signed[i], err = SafeSignMultisigRaw(request, member, mixinnet.GenerateKey(rand.Reader))
+		require.NoError(t, err)
+
+		met, err := SafeSignatureCountReached(signed[i], request.SendersThreshold)
+		require.NoError(t, err)
+		assert.False(t, met)
+	}
+
+	merged, err := MergeSafeSignatures(signed...)
+	require.NoError(t, err)
+
+	met, err := SafeSignatureCountReached(merged, request.SendersThreshold)
+	require.NoError(t, err)
+	assert.True(t, met)
+
+	mergedTx, err := mixinnet.TransactionFromRaw(merged)
+	require.NoError(t, err)
+	for _, sigs := range mergedTx.Signatures {
+		assert.Len(t, sigs, 2)
+		assert.Contains(t, sigs, uint16(0))
+		assert.Contains(t, sigs, uint16(1))
+	}
+
+	// member 0 signs again with another key
+	conflict, err := SafeSignMultisigRaw(request, members[0], mixinnet.GenerateKey(rand.Reader))
+	require.NoError(t, err)
+	_, err = MergeSafeSignatures(merged, conflict)
+	assert.Error(t, err)
+
+	b.Memo = "another"
+	other, err := b.Build()
+	require.NoError(t, err)
+	otherRaw, err := other.Dump()
+	require.NoError(t, err)
+	_, err = MergeSafeSignatures(merged, otherRaw)
+	assert.Error(t, err)
+
+	// malformed signature slots don't panic
+	malformed, err := mixinnet.TransactionFromRaw(signed[1])
+	require.NoError(t, err)
+	malformed.Signatures = append(malformed.Signatures, malformed.Signatures[0])
+	malformedRaw, err := malformed.Dump()
+	require.NoError(t, err)
+	_, err = MergeSafeSignatures(signed[0], malformedRaw)
+	assert.Error(t, err)
+	_, err = MergeSafeSignatures(malformedRaw, signed[0])
+	assert.Error(t, err)
+}
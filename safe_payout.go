@@ -0,0 +1,187 @@
+package mixin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/fox-one/mixin-sdk-go/v2/mixinnet"
+	"github.com/gofrs/uuid/v5"
+	"github.com/shopspring/decimal"
+)
+
+// maxSafePayoutOutputs is the outputs of one payout transaction, one output is kept for the change
+const maxSafePayoutOutputs = mixinnet.SliceCountLimit - 1
+
+type SafePayoutEntry struct {
+	Address *MixAddress
+	Amount  decimal.Decimal
+	// Memo is the extra of the transaction, entries with the same memo are packed together
+	Memo string
+}
+
+// SafePayoutResult is the result of the entry at Index
+type SafePayoutResult struct {
+	Index           int
+	Entry           *SafePayoutEntry
+	RequestID       string
+	TransactionHash string
+	// OutputIndex of the entry in the transaction
+	OutputIndex int
+	Err         error
+}
+
+type safePayoutChunk struct {
+	requestID string
+	memo      string
+	entries   []int
+}
+
+// planSafePayouts groups the entries by memo, in the order of first appearance,
+// and splits the groups into chunks of at most maxOutputs entries
+func planSafePayouts(requestID string, entries []*SafePayoutEntry, maxOutputs int) []*safePayoutChunk {
+	var (
+		memos  []string
+		groups = make(map[string][]int)
+	)
+
+	for idx, entry := range entries {
+		if _, ok := groups[entry.Memo]; !ok {
+			memos = append(memos, entry.Memo)
+		}
+
+		groups[entry.Memo] = append(groups[entry.Memo], idx)
+	}
+
+	var chunks []*safePayoutChunk
+	for _, memo := range memos {
+		group := groups[memo]
+		for len(group) > 0 {
+			n := maxOutputs
+			if n > len(group) {
+				n = len(group)
+			}
+
+			chunks = append(chunks, &safePayoutChunk{
+				requestID: uuidHash([]byte(fmt.Sprintf("%s:%d", requestID, len(chunks)))),
+				memo:      memo,
+				entries:   group[:n],
+			})
+			group = group[n:]
+		}
+	}
+
+	return chunks
+}
+
+func validateSafePayoutEntries(entries []*SafePayoutEntry) error {
+	if len(entries) == 0 {
+		return errors.New("empty payout entries")
+	}
+
+	for idx, entry := range entries {
+		if entry.Address == nil {
+			return fmt.Errorf("entry %d: empty address", idx)
+		}
+
+		if !entry.Amount.IsPositive() {
+			return fmt.Errorf("entry %d: invalid amount %s", idx, entry.Amount)
+		}
+
+		if len(entry.Memo) > mixinnet.ExtraSizeGeneralLimit {
+			return fmt.Errorf("entry %d: memo too long", idx)
+		}
+	}
+
+	return nil
+}
+
+// SafeBatchPayout pays the asset to the entries with as few transactions as possible,
+// every transaction pays up to 255 entries with the same memo. The request id of the
+// n-th transaction is derived from requestID and n, so calling it again with the same
+// entries resumes the payout without paying twice. Results are in the order of entries,
+// failed transactions are reported by their results and the joined error.
+func (c *Client) SafeBatchPayout(ctx context.Context, assetID, requestID string, entries []*SafePayoutEntry, spendKey mixinnet.Key) ([]*SafePayoutResult, error) {
+	if _, err := uuid.FromString(requestID); err != nil {
+		return nil, fmt.Errorf("invalid request id %q", requestID)
+	}
+
+	if err := validateSafePayoutEntries(entries); err != nil {
+		return nil, err
+	}
+
+	results := make([]*SafePayoutResult, len(entries))
+	for idx, entry := range entries {
+		results[idx] = &SafePayoutResult{Index: idx, Entry: entry}
+	}
+
+	var errs []error
+	for _, chunk := range planSafePayouts(requestID, entries, maxSafePayoutOutputs) {
+		request, err := c.safePayoutChunk(ctx, assetID, chunk, entries, spendKey)
+		for i, idx := range chunk.entries {
+			r := results[idx]
+			r.RequestID = chunk.requestID
+			r.OutputIndex = i
+			r.Err = err
+			if request != nil {
+				r.TransactionHash = request.TransactionHash
+			}
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return results, err
+			}
+
+			errs = append(errs, fmt.Errorf("payout %s: %w", chunk.requestID, err))
+		}
+	}
+
+	return results, errors.Join(errs...)
+}
+
+func (c *Client) safePayoutChunk(ctx context.Context, assetID string, chunk *safePayoutChunk, entries []*SafePayoutEntry, spendKey mixinnet.Key) (*SafeTransactionRequest, error) {
+	var (
+		total   decimal.Decimal
+		outputs = make([]*TransactionOutput, len(chunk.entries))
+	)
+
+	for i, idx := range chunk.entries {
+		entry := entries[idx]
+		total = total.Add(entry.Amount)
+		outputs[i] = &TransactionOutput{
+			Address: entry.Address,
+			Amount:  entry.Amount,
+		}
+	}
+
+	if request, err := c.safeReadTransactionRequest(ctx, chunk.requestID); err != nil {
+		return nil, err
+	} else if request != nil {
+		// the entries must be the same as the first call to resume
+		if err := verifySafeTransactionRequest(request, assetID, outputs); err != nil {
+			return nil, err
+		}
+
+		return c.safeSignAndSubmit(ctx, request, spendKey)
+	}
+
+	selection, err := c.SafeSelectUtxos(ctx, SafeSelectUtxosInput{
+		AssetID: assetID,
+		Amount:  total,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	b := NewSafeTransactionBuilder(selection.Inputs)
+	b.Memo = chunk.memo
+	b.Hint = chunk.requestID
+
+	tx, err := c.MakeTransaction(ctx, b, outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.safeCreateSignAndSubmit(ctx, chunk.requestID, tx, spendKey)
+}
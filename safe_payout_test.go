@@ -0,0 +1,48 @@
+package mixin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fox-one/mixin-sdk-go/v2/mixinnet"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanSafePayouts(t *testing.T) {
+	addr := RequireNewMixAddress([]string{newUUID()}, 1)
+
+	var entries []*SafePayoutEntry
+	for i := 0; i < 600; i++ {
+		memo := "salary"
+		if i%3 == 0 {
+			memo = "bonus"
+		}
+
+		entries = append(entries, &SafePayoutEntry{Address: addr, Amount: decimal.NewFromInt(1), Memo: memo})
+	}
+	require.NoError(t, validateSafePayoutEntries(entries))
+
+	requestID := newUUID()
+	chunks := planSafePayouts(requestID, entries, maxSafePayoutOutputs)
+	// 200 bonus, 400 salary
+	require.Len(t, chunks, 3)
+	assert.Equal(t, "bonus", chunks[0].memo)
+	assert.Len(t, chunks[0].entries, 200)
+	assert.Equal(t, "salary", chunks[1].memo)
+	assert.Len(t, chunks[1].entries, 255)
+	assert.Len(t, chunks[2].entries, 145)
+	assert.Equal(t, 1, chunks[1].entries[0])
+
+	again := planSafePayouts(requestID, entries, maxSafePayoutOutputs)
+	for i := range chunks {
+		assert.Equal(t, chunks[i].requestID, again[i].requestID, "deterministic request id")
+	}
+
+	_, err := NewFromAccessToken("token").SafeBatchPayout(context.Background(), newUUID(), "payroll", entries, mixinnet.Key{})
+	assert.Error(t, err, "request id must be uuid")
+
+	entries[0].Amount = decimal.Zero
+	assert.Error(t, validateSafePayoutEntries(entries))
+}
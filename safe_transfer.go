@@ -0,0 +1,238 @@
+package mixin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/fox-one/mixin-sdk-go/v2/mixinnet"
+	"github.com/gofrs/uuid/v5"
+	"github.com/shopspring/decimal"
+)
+
+type SafeTransferInput struct {
+	// RequestID is the idempotency key of the transfer, required
+	RequestID string
+	AssetID   string
+	Amount    decimal.Decimal
+	// Receivers & Threshold, or MixAddress, is the opponent
+	Receivers  []string
+	Threshold  uint8
+	MixAddress *MixAddress
+	Memo       string
+	// Strategy selects the utxos, default is CoinSelectLargestFirst
+	Strategy CoinSelectStrategy
+}
+
+func (input *SafeTransferInput) address() (*MixAddress, error) {
+	if input.MixAddress != nil {
+		return input.MixAddress, nil
+	}
+
+	threshold := input.Threshold
+	if threshold == 0 {
+		threshold = 1
+	}
+
+	return NewMixAddress(input.Receivers, threshold)
+}
+
+func (input *SafeTransferInput) validate() error {
+	if _, err := uuid.FromString(input.RequestID); err != nil {
+		return fmt.Errorf("invalid request id %q", input.RequestID)
+	}
+
+	if _, err := uuid.FromString(input.AssetID); err != nil {
+		return fmt.Errorf("invalid asset id %q", input.AssetID)
+	}
+
+	if !input.Amount.IsPositive() {
+		return fmt.Errorf("invalid amount %s", input.Amount)
+	}
+
+	if len(input.Memo) > mixinnet.ExtraSizeGeneralLimit {
+		return errors.New("memo too long")
+	}
+
+	return nil
+}
+
+// SafeTransfer transfers the asset to the receivers, it selects the utxos, builds and
+// signs the transaction then submits it. It is idempotent by the request id, the
+// transaction request already created is signed and submitted instead of a new one.
+func (c *Client) SafeTransfer(ctx context.Context, input SafeTransferInput, spendKey mixinnet.Key) (*SafeTransactionRequest, error) {
+	if err := input.validate(); err != nil {
+		return nil, err
+	}
+
+	addr, err := input.address()
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := []*TransactionOutput{
+		{
+			Address: addr,
+			Amount:  input.Amount,
+		},
+	}
+
+	if request, err := c.safeReadTransactionRequest(ctx, input.RequestID); err != nil {
+		return nil, err
+	} else if request != nil {
+		if err := verifySafeTransactionRequest(request, input.AssetID, outputs); err != nil {
+			return nil, err
+		}
+
+		return c.safeSignAndSubmit(ctx, request, spendKey)
+	}
+
+	selection, err := c.SafeSelectUtxos(ctx, SafeSelectUtxosInput{
+		AssetID:  input.AssetID,
+		Amount:   input.Amount,
+		Strategy: input.Strategy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	b := NewSafeTransactionBuilder(selection.Inputs)
+	b.Memo = input.Memo
+	// ghost keys are derived from the hint
+	b.Hint = input.RequestID
+
+	tx, err := c.MakeTransaction(ctx, b, outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.safeCreateSignAndSubmit(ctx, input.RequestID, tx, spendKey)
+}
+
+// safeReadTransactionRequest returns nil if the request is not found
+func (c *Client) safeReadTransactionRequest(ctx context.Context, requestID string) (*SafeTransactionRequest, error) {
+	request, err := c.SafeReadTransactionRequest(ctx, requestID)
+	if err != nil {
+		if IsErrorCodes(err, EndpointNotFound) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return request, nil
+}
+
+// verifySafeTransactionRequest checks the request found by the request id pays the outputs
+// of the asset in order, so a request id reused with other parameters is never signed.
+// Outputs after them, like the change, are not checked.
+func verifySafeTransactionRequest(request *SafeTransactionRequest, assetID string, outputs []*TransactionOutput) error {
+	tx, err := mixinnet.TransactionFromRaw(request.RawTransaction)
+	if err != nil {
+		return err
+	}
+
+	if asset := mixinnet.NewHash([]byte(assetID)); tx.Asset != asset {
+		return fmt.Errorf("request %s: asset %s mismatch, expect %s", request.RequestID, tx.Asset, asset)
+	}
+
+	if len(tx.Outputs) < len(outputs) || len(request.Receivers) < len(outputs) {
+		return fmt.Errorf("request %s: %d outputs mismatch, expect %d", request.RequestID, len(tx.Outputs), len(outputs))
+	}
+
+	for idx, output := range outputs {
+		if amount := mixinnet.IntegerFromDecimal(output.Amount); tx.Outputs[idx].Amount.Cmp(amount) != 0 {
+			return fmt.Errorf("request %s: output %d amount %s mismatch, expect %s", request.RequestID, idx, tx.Outputs[idx].Amount, amount)
+		}
+
+		receiver := request.Receivers[idx]
+		members, expect := slices.Sorted(slices.Values(receiver.Members)), slices.Sorted(slices.Values(output.Address.Members()))
+		if receiver.Threshold != output.Address.Threshold || !slices.Equal(members, expect) {
+			return fmt.Errorf("request %s: output %d receivers mismatch", request.RequestID, idx)
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) safeCreateSignAndSubmit(ctx context.Context, requestID string, tx *mixinnet.Transaction, spendKey mixinnet.Key) (*SafeTransactionRequest, error) {
+	raw, err := tx.Dump()
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := c.SafeCreateTransactionRequest(ctx, &SafeTransactionRequestInput{
+		RequestID:      requestID,
+		RawTransaction: raw,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.safeSignAndSubmit(ctx, request, spendKey)
+}
+
+// safeSignAndSubmit signs the raw transaction of the request with its views and submits it,
+// requests already signed or spent are returned as they are
+func (c *Client) safeSignAndSubmit(ctx context.Context, request *SafeTransactionRequest, spendKey mixinnet.Key) (*SafeTransactionRequest, error) {
+	requests, err := c.safeSignAndSubmitAll(ctx, []*SafeTransactionRequest{request}, spendKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return requests[0], nil
+}
+
+// safeSignAndSubmitAll is same as safeSignAndSubmit but submits the requests together
+func (c *Client) safeSignAndSubmitAll(ctx context.Context, requests []*SafeTransactionRequest, spendKey mixinnet.Key) ([]*SafeTransactionRequest, error) {
+	var inputs []*SafeTransactionRequestInput
+	for _, request := range requests {
+		if request.State != "" && request.State != SafeUtxoStateUnspent {
+			continue
+		}
+
+		tx, err := mixinnet.TransactionFromRaw(request.RawTransaction)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := SafeSignTransaction(tx, spendKey, request.Views, 0); err != nil {
+			return nil, err
+		}
+
+		raw, err := tx.Dump()
+		if err != nil {
+			return nil, err
+		}
+
+		inputs = append(inputs, &SafeTransactionRequestInput{
+			RequestID:      request.RequestID,
+			RawTransaction: raw,
+		})
+	}
+
+	results := make([]*SafeTransactionRequest, len(requests))
+	copy(results, requests)
+	if len(inputs) == 0 {
+		return results, nil
+	}
+
+	submitted, err := c.SafeSubmitTransactionRequests(ctx, inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]*SafeTransactionRequest, len(submitted))
+	for _, request := range submitted {
+		index[request.RequestID] = request
+	}
+
+	for idx, request := range results {
+		if r, ok := index[request.RequestID]; ok {
+			results[idx] = r
+		}
+	}
+
+	return results, nil
+}
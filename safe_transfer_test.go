@@ -0,0 +1,105 @@
+package mixin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fox-one/mixin-sdk-go/v2/mixinnet"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSafeTransferInputValidate(t *testing.T) {
+	input := SafeTransferInput{
+		RequestID: newUUID(),
+		AssetID:   newUUID(),
+		Amount:    decimal.NewFromInt(1),
+		Receivers: []string{newUUID()},
+	}
+	assert.NoError(t, input.validate())
+
+	addr, err := input.address()
+	require.NoError(t, err)
+	assert.Equal(t, byte(1), addr.Threshold)
+
+	input.Amount = decimal.Zero
+	assert.Error(t, input.validate())
+
+	input.Amount = decimal.NewFromInt(1)
+	input.RequestID = "order-1"
+	assert.Error(t, input.validate(), "request id must be uuid")
+}
+
+func TestVerifySafeTransactionRequest(t *testing.T) {
+	assetID, receiver := newUUID(), newUUID()
+	utxos := newTestUtxos(5)
+	utxos[0].KernelAssetID = mixinnet.NewHash([]byte(assetID))
+	utxos[0].TransactionHash = mixinnet.NewHash([]byte(utxos[0].OutputID))
+	utxos[0].Receivers = []string{newUUID()}
+	utxos[0].ReceiversThreshold = 1
+
+	b := NewSafeTransactionBuilder(utxos)
+	for _, amount := range []int64{2, 3} {
+		b.Outputs = append(b.Outputs, &mixinnet.Output{
+			Type:   mixinnet.OutputTypeScript,
+			Amount: mixinnet.IntegerFromDecimal(decimal.NewFromInt(amount)),
+			Script: mixinnet.NewThresholdScript(1),
+		})
+	}
+	tx, err := b.Build()
+	require.NoError(t, err)
+	raw, err := tx.Dump()
+	require.NoError(t, err)
+
+	request := &SafeTransactionRequest{
+		RequestID:      newUUID(),
+		RawTransaction: raw,
+		Receivers:      []*SafeTransactionReceiver{{Members: []string{receiver}, Threshold: 1}},
+	}
+
+	outputs := []*TransactionOutput{{Address: RequireNewMixAddress([]string{receiver}, 1), Amount: decimal.NewFromInt(2)}}
+	assert.NoError(t, verifySafeTransactionRequest(request, assetID, outputs))
+	assert.Error(t, verifySafeTransactionRequest(request, newUUID(), outputs), "asset mismatch")
+
+	outputs[0].Amount = decimal.NewFromInt(3)
+	assert.Error(t, verifySafeTransactionRequest(request, assetID, outputs), "amount mismatch")
+
+	outputs[0] = &TransactionOutput{Address: RequireNewMixAddress([]string{newUUID()}, 1), Amount: decimal.NewFromInt(2)}
+	assert.Error(t, verifySafeTransactionRequest(request, assetID, outputs), "receivers mismatch")
+
+	outputs = append(outputs, outputs[0], outputs[0])
+	assert.Error(t, verifySafeTransactionRequest(request, assetID, outputs), "more outputs")
+}
+
+func TestSafeTransfer(t *testing.T) {
+	ctx := context.Background()
+	store := newKeystoreFromEnv(t)
+	dapp, err := NewFromKeystore(&store.Keystore)
+	require.NoError(t, err, "init bot client")
+
+	utxos, err := dapp.SafeListUtxos(ctx, SafeListUtxoOption{
+		Limit: 1,
+		State: SafeUtxoStateUnspent,
+	})
+	require.NoError(t, err, "SafeListUtxos")
+	if len(utxos) == 0 {
+		t.Log("empty unspent utxo")
+		return
+	}
+
+	input := SafeTransferInput{
+		RequestID: newUUID(),
+		AssetID:   utxos[0].AssetID,
+		Amount:    decimal.New(1, -8),
+		Receivers: []string{dapp.ClientID},
+		Memo:      "TestSafeTransfer",
+	}
+
+	request, err := dapp.SafeTransfer(ctx, input, store.SpendKey)
+	require.NoError(t, err, "SafeTransfer")
+
+	again, err := dapp.SafeTransfer(ctx, input, store.SpendKey)
+	require.NoError(t, err, "SafeTransfer again")
+	assert.Equal(t, request.TransactionHash, again.TransactionHash, "idempotent")
+}
@@ -0,0 +1,315 @@
+package mixin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fox-one/mixin-sdk-go/v2/mixinnet"
+	"github.com/shopspring/decimal"
+)
+
+// SafeUtxoStore persists the utxos synced by SafeUtxoSyncer
+type SafeUtxoStore interface {
+	// ReadSafeUtxoCursor returns the sequence to sync from of the cursor key, 0 if not found
+	ReadSafeUtxoCursor(ctx context.Context, key string) (uint64, error)
+	// SaveSafeUtxos upserts the utxos and updates the cursor in one step
+	SaveSafeUtxos(ctx context.Context, key string, utxos []*SafeUtxo, cursor uint64) error
+	// ListSafeUtxos returns the utxos matching the filter in sequence order
+	ListSafeUtxos(ctx context.Context, filter SafeUtxoFilter) ([]*SafeUtxo, error)
+}
+
+// SafeUtxoFilter filters the utxos in SafeUtxoStore, empty fields match all
+type SafeUtxoFilter struct {
+	AssetID       string
+	ReceiversHash mixinnet.Hash
+	State         SafeUtxoState
+}
+
+func (f SafeUtxoFilter) match(utxo *SafeUtxo) bool {
+	if f.AssetID != "" && utxo.AssetID != f.AssetID {
+		return false
+	}
+
+	if f.ReceiversHash.HasValue() && utxo.ReceiversHash != f.ReceiversHash {
+		return false
+	}
+
+	return f.State == "" || utxo.State == f.State
+}
+
+// SafeUtxoSyncSource is a set of utxos to sync, by default the utxos of the client
+type SafeUtxoSyncSource struct {
+	Members           []string
+	Threshold         uint8
+	IncludeSubWallets bool
+}
+
+// SafeUtxoSyncer pulls the utxos incrementally by sequence into a SafeUtxoStore. The
+// utxos of every state are pulled with their own cursors, so the transitions
+// unspent -> signed -> spent, and signed -> unspent when the transaction is unlocked
+// or expired, are tracked. The store keeps the copy of an utxo with the highest
+// sequence, a page listed late with an older copy doesn't revert it.
+type SafeUtxoSyncer struct {
+	client  *Client
+	store   SafeUtxoStore
+	sources []SafeUtxoSyncSource
+
+	// list pages the utxos, client.SafeListUtxos by default
+	list func(ctx context.Context, opt SafeListUtxoOption) ([]*SafeUtxo, error)
+}
+
+func NewSafeUtxoSyncer(client *Client, store SafeUtxoStore, sources ...SafeUtxoSyncSource) *SafeUtxoSyncer {
+	if len(sources) == 0 {
+		sources = []SafeUtxoSyncSource{{}}
+	}
+
+	return &SafeUtxoSyncer{
+		client:  client,
+		store:   store,
+		sources: sources,
+		list:    client.SafeListUtxos,
+	}
+}
+
+func (s *SafeUtxoSyncer) cursorKey(source SafeUtxoSyncSource, state SafeUtxoState) string {
+	members := source.Members
+	if len(members) == 0 {
+		members = []string{s.client.ClientID}
+	}
+
+	threshold := source.Threshold
+	if threshold == 0 {
+		threshold = 1
+	}
+
+	return fmt.Sprintf("%s:%d:%t:%s", mixinnet.HashMembers(members), threshold, source.IncludeSubWallets, state)
+}
+
+// Sync pulls the new utxos of all sources once
+func (s *SafeUtxoSyncer) Sync(ctx context.Context) error {
+	for _, source := range s.sources {
+		for _, state := range []SafeUtxoState{SafeUtxoStateUnspent, SafeUtxoStateSigned, SafeUtxoStateSpent} {
+			if err := s.sync(ctx, source, state); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *SafeUtxoSyncer) sync(ctx context.Context, source SafeUtxoSyncSource, state SafeUtxoState) error {
+	key := s.cursorKey(source, state)
+	cursor, err := s.store.ReadSafeUtxoCursor(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return walkSafeUtxos(ctx, s.list, SafeListUtxoOption{
+		Members:           source.Members,
+		Threshold:         source.Threshold,
+		IncludeSubWallets: source.IncludeSubWallets,
+		State:             state,
+		Offset:            cursor,
+	}, func(utxos []*SafeUtxo) error {
+		return s.store.SaveSafeUtxos(ctx, key, utxos, utxos[len(utxos)-1].Sequence+1)
+	})
+}
+
+// Run syncs every interval until ctx is done, sync errors are retried in the next round
+func (s *SafeUtxoSyncer) Run(ctx context.Context, interval time.Duration, onError func(err error)) error {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	for {
+		if err := s.Sync(ctx); err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+
+		if err := sleepContext(ctx, interval); err != nil {
+			return err
+		}
+	}
+}
+
+// Utxos returns the synced utxos matching the filter
+func (s *SafeUtxoSyncer) Utxos(ctx context.Context, filter SafeUtxoFilter) ([]*SafeUtxo, error) {
+	return s.store.ListSafeUtxos(ctx, filter)
+}
+
+// Balance returns the total amount of the unspent utxos of the asset,
+// receiversHash is optional
+func (s *SafeUtxoSyncer) Balance(ctx context.Context, assetID string, receiversHash mixinnet.Hash) (decimal.Decimal, error) {
+	utxos, err := s.store.ListSafeUtxos(ctx, SafeUtxoFilter{
+		AssetID:       assetID,
+		ReceiversHash: receiversHash,
+		State:         SafeUtxoStateUnspent,
+	})
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	return sumSafeUtxos(utxos), nil
+}
+
+// Balances returns the total amount of the unspent utxos per asset, receiversHash is optional
+func (s *SafeUtxoSyncer) Balances(ctx context.Context, receiversHash mixinnet.Hash) (map[string]decimal.Decimal, error) {
+	utxos, err := s.store.ListSafeUtxos(ctx, SafeUtxoFilter{
+		ReceiversHash: receiversHash,
+		State:         SafeUtxoStateUnspent,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make(map[string]decimal.Decimal)
+	for _, utxo := range utxos {
+		balances[utxo.AssetID] = balances[utxo.AssetID].Add(utxo.Amount)
+	}
+
+	return balances, nil
+}
+
+type memorySafeUtxoStore struct {
+	cursors map[string]uint64
+	utxos   map[string]*SafeUtxo
+	mux     sync.Mutex
+}
+
+// NewMemorySafeUtxoStore returns a SafeUtxoStore living in memory
+func NewMemorySafeUtxoStore() SafeUtxoStore {
+	return newMemorySafeUtxoStore()
+}
+
+func newMemorySafeUtxoStore() *memorySafeUtxoStore {
+	return &memorySafeUtxoStore{
+		cursors: make(map[string]uint64),
+		utxos:   make(map[string]*SafeUtxo),
+	}
+}
+
+func (s *memorySafeUtxoStore) ReadSafeUtxoCursor(_ context.Context, key string) (uint64, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.cursors[key], nil
+}
+
+// save upserts the utxos, an utxo is replaced only by a copy with a higher sequence,
+// so a spent utxo listed by an old unspent page stays spent
+func (s *memorySafeUtxoStore) save(key string, utxos []*SafeUtxo, cursor uint64) {
+	for _, utxo := range utxos {
+		if old, ok := s.utxos[utxo.OutputID]; ok && utxo.Sequence <= old.Sequence {
+			continue
+		}
+
+		s.utxos[utxo.OutputID] = utxo
+	}
+
+	if cursor > s.cursors[key] {
+		s.cursors[key] = cursor
+	}
+}
+
+func (s *memorySafeUtxoStore) SaveSafeUtxos(_ context.Context, key string, utxos []*SafeUtxo, cursor uint64) error {
+	s.mux.Lock()
+	s.save(key, utxos, cursor)
+	s.mux.Unlock()
+	return nil
+}
+
+func (s *memorySafeUtxoStore) ListSafeUtxos(_ context.Context, filter SafeUtxoFilter) ([]*SafeUtxo, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var utxos []*SafeUtxo
+	for _, utxo := range s.utxos {
+		if filter.match(utxo) {
+			utxos = append(utxos, utxo)
+		}
+	}
+
+	sort.Slice(utxos, func(i, j int) bool {
+		if utxos[i].Sequence != utxos[j].Sequence {
+			return utxos[i].Sequence < utxos[j].Sequence
+		}
+
+		return utxos[i].OutputID < utxos[j].OutputID
+	})
+
+	return utxos, nil
+}
+
+type safeUtxoJournalEntry struct {
+	Key    string      `json:"key"`
+	Cursor uint64      `json:"cursor"`
+	Utxos  []*SafeUtxo `json:"utxos,omitempty"`
+}
+
+// FileSafeUtxoStore is a SafeUtxoStore persisted as an append only journal file
+type FileSafeUtxoStore struct {
+	*memorySafeUtxoStore
+	journal *journal[safeUtxoJournalEntry]
+}
+
+// NewFileSafeUtxoStore opens the journal file at path,
+// the journal is compacted every time the store is opened
+func NewFileSafeUtxoStore(path string) (*FileSafeUtxoStore, error) {
+	s := &FileSafeUtxoStore{
+		memorySafeUtxoStore: newMemorySafeUtxoStore(),
+	}
+
+	j, err := openJournal(path, 64*1024*1024, s.apply, s.snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	s.journal = j
+	return s, nil
+}
+
+func (s *FileSafeUtxoStore) apply(entry safeUtxoJournalEntry) {
+	s.save(entry.Key, entry.Utxos, entry.Cursor)
+}
+
+func (s *FileSafeUtxoStore) snapshot() []safeUtxoJournalEntry {
+	utxos, _ := s.memorySafeUtxoStore.ListSafeUtxos(context.Background(), SafeUtxoFilter{})
+
+	var entries []safeUtxoJournalEntry
+	for key, cursor := range s.cursors {
+		entries = append(entries, safeUtxoJournalEntry{Key: key, Cursor: cursor})
+	}
+
+	// keep the lines short
+	for len(utxos) > 0 {
+		n := min(safeListUtxosPageSize, len(utxos))
+		entries = append(entries, safeUtxoJournalEntry{Utxos: utxos[:n]})
+		utxos = utxos[n:]
+	}
+
+	return entries
+}
+
+func (s *FileSafeUtxoStore) SaveSafeUtxos(_ context.Context, key string, utxos []*SafeUtxo, cursor uint64) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if err := s.journal.write(safeUtxoJournalEntry{Key: key, Cursor: cursor, Utxos: utxos}); err != nil {
+		return err
+	}
+
+	s.save(key, utxos, cursor)
+	return nil
+}
+
+// Close closes the journal file
+func (s *FileSafeUtxoStore) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.journal.Close()
+}
@@ -0,0 +1,164 @@
+package mixin
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/fox-one/mixin-sdk-go/v2/mixinnet"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSafeUtxoStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "utxos")
+
+	store, err := NewFileSafeUtxoStore(path)
+	require.NoError(t, err)
+
+	utxos := newTestUtxos(1, 2, 3)
+	receivers := mixinnet.NewHash([]byte("receivers"))
+	for _, utxo := range utxos {
+		utxo.ReceiversHash = receivers
+	}
+
+	require.NoError(t, store.SaveSafeUtxos(ctx, "unspent", utxos, 4))
+
+	spent := *utxos[1]
+	spent.State = SafeUtxoStateSpent
+	spent.Sequence = 4
+	require.NoError(t, store.SaveSafeUtxos(ctx, "spent", []*SafeUtxo{&spent}, 5))
+
+	// an old unspent page with a lower or equal sequence doesn't revert the state
+	stale := *utxos[1]
+	require.NoError(t, store.SaveSafeUtxos(ctx, "unspent", []*SafeUtxo{&stale}, 2))
+	stale.Sequence = spent.Sequence
+	require.NoError(t, store.SaveSafeUtxos(ctx, "unspent", []*SafeUtxo{&stale}, 2))
+	require.NoError(t, store.Close())
+
+	store, err = NewFileSafeUtxoStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	cursor, err := store.ReadSafeUtxoCursor(ctx, "unspent")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), cursor)
+
+	syncer := NewSafeUtxoSyncer(&Client{}, store)
+
+	balance, err := syncer.Balance(ctx, utxos[0].AssetID, receivers)
+	require.NoError(t, err)
+	assert.Equal(t, "4", balance.String())
+
+	balance, err = syncer.Balance(ctx, utxos[0].AssetID, mixinnet.NewHash([]byte("others")))
+	require.NoError(t, err)
+	assert.True(t, balance.IsZero())
+
+	balances, err := syncer.Balances(ctx, mixinnet.Hash{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]decimal.Decimal{utxos[0].AssetID: decimal.NewFromInt(4)}, balances)
+
+	list, err := syncer.Utxos(ctx, SafeUtxoFilter{State: SafeUtxoStateSpent})
+	require.NoError(t, err)
+	if assert.Len(t, list, 1) {
+		assert.Equal(t, utxos[1].OutputID, list[0].OutputID)
+	}
+}
+
+// testSafeUtxoAPI mimics the safe outputs api, the sequence of an utxo is renewed when its state changes
+type testSafeUtxoAPI struct {
+	seq   uint64
+	utxos map[string]*SafeUtxo
+}
+
+func (api *testSafeUtxoAPI) set(utxo *SafeUtxo, state SafeUtxoState) {
+	api.seq++
+	u := *utxo
+	u.State = state
+	u.Sequence = api.seq
+	api.utxos[u.OutputID] = &u
+}
+
+func (api *testSafeUtxoAPI) list(_ context.Context, opt SafeListUtxoOption) ([]*SafeUtxo, error) {
+	var utxos []*SafeUtxo
+	for _, utxo := range api.utxos {
+		if utxo.State == opt.State && utxo.Sequence >= opt.Offset {
+			u := *utxo
+			utxos = append(utxos, &u)
+		}
+	}
+
+	sort.Slice(utxos, func(i, j int) bool { return utxos[i].Sequence < utxos[j].Sequence })
+	if len(utxos) > opt.Limit {
+		utxos = utxos[:opt.Limit]
+	}
+
+	return utxos, nil
+}
+
+func TestSafeUtxoSyncerSync(t *testing.T) {
+	ctx := context.Background()
+	api := &testSafeUtxoAPI{utxos: map[string]*SafeUtxo{}}
+	store := NewMemorySafeUtxoStore()
+	syncer := NewSafeUtxoSyncer(&Client{ClientID: newUUID()}, store)
+	syncer.list = api.list
+
+	utxos := newTestUtxos(1, 2, 3, 4)
+	a, b, c, d := utxos[0], utxos[1], utxos[2], utxos[3]
+	for _, utxo := range utxos[:3] {
+		api.set(utxo, SafeUtxoStateUnspent)
+	}
+
+	states := func() map[string]SafeUtxoState {
+		list, err := syncer.Utxos(ctx, SafeUtxoFilter{})
+		require.NoError(t, err)
+
+		m := make(map[string]SafeUtxoState, len(list))
+		for _, utxo := range list {
+			m[utxo.OutputID] = utxo.State
+		}
+		return m
+	}
+
+	require.NoError(t, syncer.Sync(ctx))
+	assert.Equal(t, map[string]SafeUtxoState{a.OutputID: SafeUtxoStateUnspent, b.OutputID: SafeUtxoStateUnspent, c.OutputID: SafeUtxoStateUnspent}, states())
+
+	// the spent cursor moves past the sequences of a and c
+	api.set(b, SafeUtxoStateSpent)
+	api.set(d, SafeUtxoStateUnspent)
+	require.NoError(t, syncer.Sync(ctx))
+	assert.Equal(t, SafeUtxoStateSpent, states()[b.OutputID])
+	assert.Equal(t, SafeUtxoStateUnspent, states()[d.OutputID])
+
+	api.set(a, SafeUtxoStateSigned)
+	require.NoError(t, syncer.Sync(ctx))
+	assert.Equal(t, SafeUtxoStateSigned, states()[a.OutputID])
+
+	// a: signed -> unspent, the transaction is unlocked
+	api.set(a, SafeUtxoStateUnspent)
+	require.NoError(t, syncer.Sync(ctx))
+	assert.Equal(t, SafeUtxoStateUnspent, states()[a.OutputID])
+
+	api.set(a, SafeUtxoStateSigned)
+	require.NoError(t, syncer.Sync(ctx))
+	assert.Equal(t, SafeUtxoStateSigned, states()[a.OutputID])
+
+	// a: signed -> spent, c: unspent -> signed -> spent between two syncs
+	api.set(a, SafeUtxoStateSpent)
+	api.set(c, SafeUtxoStateSigned)
+	api.set(c, SafeUtxoStateSpent)
+	require.NoError(t, syncer.Sync(ctx))
+	assert.Equal(t, map[string]SafeUtxoState{
+		a.OutputID: SafeUtxoStateSpent,
+		b.OutputID: SafeUtxoStateSpent,
+		c.OutputID: SafeUtxoStateSpent,
+		d.OutputID: SafeUtxoStateUnspent,
+	}, states())
+
+	balance, err := syncer.Balance(ctx, d.AssetID, mixinnet.Hash{})
+	require.NoError(t, err)
+	assert.Equal(t, "4", balance.String())
+}
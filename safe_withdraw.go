@@ -0,0 +1,293 @@
+package mixin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/fox-one/mixin-sdk-go/v2/mixinnet"
+	"github.com/gofrs/uuid/v5"
+	"github.com/shopspring/decimal"
+)
+
+// MixinFeeUserID receives the withdrawal fees
+const MixinFeeUserID = "674d6776-d600-4346-af46-58e77d8df185"
+
+// SafeWithdrawalFeeRequestID returns the request id of the fee transaction of the withdrawal
+// if the fee asset is not the withdrawal asset
+func SafeWithdrawalFeeRequestID(requestID string) string {
+	return uuidHash([]byte(requestID + ":fee"))
+}
+
+func newWithdrawalOutput(destination, tag string, amount decimal.Decimal) *mixinnet.Output {
+	return &mixinnet.Output{
+		Type:   mixinnet.OutputTypeWithdrawalSubmit,
+		Amount: mixinnet.IntegerFromDecimal(amount),
+		Withdrawal: &mixinnet.WithdrawalData{
+			Address: destination,
+			Tag:     tag,
+		},
+	}
+}
+
+// SafeWithdraw withdraws the asset to the destination of the external chain. The fee is
+// paid by feeAssetID, default is the first fee option, SafeCheapestWithdrawalFee finds the
+// cheapest one. If the fee asset differs from the asset, the fee is paid by a separate
+// transaction referencing the withdrawal transaction, with request id
+// SafeWithdrawalFeeRequestID(requestID). It is idempotent by requestID, requests already
+// created must match the parameters and the missing fee request is created again.
+func (c *Client) SafeWithdraw(
+	ctx context.Context,
+	assetID, destination, tag string,
+	amount decimal.Decimal,
+	feeAssetID, requestID string,
+	spendKey mixinnet.Key,
+) ([]*SafeTransactionRequest, error) {
+	if _, err := uuid.FromString(requestID); err != nil {
+		return nil, fmt.Errorf("invalid request id %q", requestID)
+	}
+
+	if destination == "" {
+		return nil, errors.New("empty destination")
+	}
+
+	if !amount.IsPositive() {
+		return nil, fmt.Errorf("invalid amount %s", amount)
+	}
+
+	fees, err := c.SafeReadWithdrawalFees(ctx, assetID, destination)
+	if err != nil {
+		return nil, err
+	}
+
+	fee, err := pickWithdrawalFee(fees, feeAssetID)
+	if err != nil {
+		return nil, err
+	}
+
+	feeAddr, err := NewMixAddress([]string{MixinFeeUserID}, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		requests   []*SafeTransactionRequest
+		inputs     []*SafeTransactionRequestInput
+		withdrawal *mixinnet.Transaction
+	)
+
+	if request, err := c.safeReadTransactionRequest(ctx, requestID); err != nil {
+		return nil, err
+	} else if request != nil {
+		if withdrawal, err = verifySafeWithdrawalRequest(request, assetID, destination, tag, amount, fee); err != nil {
+			return nil, err
+		}
+
+		requests = append(requests, request)
+	} else {
+		if withdrawal, err = c.buildSafeWithdrawal(ctx, assetID, destination, tag, amount, fee, feeAddr, requestID); err != nil {
+			return nil, err
+		}
+
+		if inputs, err = appendSafeTransactionRequestInput(inputs, requestID, withdrawal); err != nil {
+			return nil, err
+		}
+	}
+
+	if fee.AssetID != assetID && fee.Amount.IsPositive() {
+		txHash, err := withdrawal.TransactionHash()
+		if err != nil {
+			return nil, err
+		}
+
+		feeRequestID := SafeWithdrawalFeeRequestID(requestID)
+		if request, err := c.safeReadTransactionRequest(ctx, feeRequestID); err != nil {
+			return nil, err
+		} else if request != nil {
+			if err := verifySafeWithdrawalFeeRequest(request, fee.AssetID, txHash); err != nil {
+				return nil, err
+			}
+
+			requests = append(requests, request)
+		} else {
+			feeTx, err := c.buildSafeWithdrawalFee(ctx, fee, feeAddr, feeRequestID, txHash)
+			if err != nil {
+				return nil, err
+			}
+
+			if inputs, err = appendSafeTransactionRequestInput(inputs, feeRequestID, feeTx); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(inputs) > 0 {
+		created, err := c.SafeCreateTransactionRequests(ctx, inputs)
+		if err != nil {
+			return nil, err
+		}
+
+		requests = append(requests, created...)
+	}
+
+	return c.safeSignAndSubmitAll(ctx, requests, spendKey)
+}
+
+// buildSafeWithdrawal builds the withdrawal transaction, the withdrawal is the first output,
+// followed by the fee output if the fee is paid by the same asset, then the change
+func (c *Client) buildSafeWithdrawal(
+	ctx context.Context,
+	assetID, destination, tag string,
+	amount decimal.Decimal,
+	fee *SafeWithdrawalFee,
+	feeAddr *MixAddress,
+	requestID string,
+) (*mixinnet.Transaction, error) {
+	withdrawAmount := amount
+	sameAsset := fee.AssetID == assetID
+	if sameAsset {
+		withdrawAmount = amount.Add(fee.Amount)
+	}
+
+	selection, err := c.SafeSelectUtxos(ctx, SafeSelectUtxosInput{
+		AssetID: assetID,
+		Amount:  withdrawAmount,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	b := NewSafeTransactionBuilder(selection.Inputs)
+	b.Hint = requestID
+	b.Outputs = append(b.Outputs, newWithdrawalOutput(destination, tag, amount))
+
+	var outputs []*TransactionOutput
+	if sameAsset && fee.Amount.IsPositive() {
+		outputs = append(outputs, &TransactionOutput{Address: feeAddr, Amount: fee.Amount})
+	}
+
+	if selection.Change.IsPositive() {
+		outputs = append(outputs, &TransactionOutput{Address: b.addr, Amount: selection.Change})
+	}
+
+	if err := c.AppendOutputsToInput(ctx, b, outputs); err != nil {
+		return nil, err
+	}
+
+	return b.Build()
+}
+
+// buildSafeWithdrawalFee builds the fee transaction referencing the withdrawal transaction
+func (c *Client) buildSafeWithdrawalFee(
+	ctx context.Context,
+	fee *SafeWithdrawalFee,
+	feeAddr *MixAddress,
+	feeRequestID string,
+	withdrawalHash mixinnet.Hash,
+) (*mixinnet.Transaction, error) {
+	selection, err := c.SafeSelectUtxos(ctx, SafeSelectUtxosInput{
+		AssetID: fee.AssetID,
+		Amount:  fee.Amount,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	b := NewSafeTransactionBuilder(selection.Inputs)
+	b.Hint = feeRequestID
+	b.References = []mixinnet.Hash{withdrawalHash}
+
+	return c.MakeTransaction(ctx, b, []*TransactionOutput{{Address: feeAddr, Amount: fee.Amount}})
+}
+
+func appendSafeTransactionRequestInput(inputs []*SafeTransactionRequestInput, requestID string, tx *mixinnet.Transaction) ([]*SafeTransactionRequestInput, error) {
+	raw, err := tx.Dump()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(inputs, &SafeTransactionRequestInput{
+		RequestID:      requestID,
+		RawTransaction: raw,
+	}), nil
+}
+
+// verifySafeWithdrawalRequest checks the withdrawal request found by the request id
+// withdraws the amount of the asset to the destination, and pays the fee within the
+// transaction only if the fee asset is the asset. It returns the withdrawal transaction.
+func verifySafeWithdrawalRequest(request *SafeTransactionRequest, assetID, destination, tag string, amount decimal.Decimal, fee *SafeWithdrawalFee) (*mixinnet.Transaction, error) {
+	tx, err := mixinnet.TransactionFromRaw(request.RawTransaction)
+	if err != nil {
+		return nil, err
+	}
+
+	if asset := mixinnet.NewHash([]byte(assetID)); tx.Asset != asset {
+		return nil, fmt.Errorf("withdrawal %s: asset %s mismatch, expect %s", request.RequestID, tx.Asset, asset)
+	}
+
+	if len(tx.Outputs) == 0 || tx.Outputs[0].Withdrawal == nil {
+		return nil, fmt.Errorf("withdrawal %s: withdrawal output not found", request.RequestID)
+	}
+
+	output := tx.Outputs[0]
+	if output.Withdrawal.Address != destination || output.Withdrawal.Tag != tag {
+		return nil, fmt.Errorf("withdrawal %s: destination %s mismatch, expect %s", request.RequestID, output.Withdrawal.Address, destination)
+	}
+
+	if expect := mixinnet.IntegerFromDecimal(amount); output.Amount.Cmp(expect) != 0 {
+		return nil, fmt.Errorf("withdrawal %s: amount %s mismatch, expect %s", request.RequestID, output.Amount, expect)
+	}
+
+	feePaid := slices.ContainsFunc(request.Receivers, isSafeWithdrawalFeeReceiver)
+	if expect := fee.AssetID == assetID && fee.Amount.IsPositive(); feePaid != expect {
+		return nil, fmt.Errorf("withdrawal %s: fee asset %s mismatch", request.RequestID, fee.AssetID)
+	}
+
+	return tx, nil
+}
+
+// verifySafeWithdrawalFeeRequest checks the fee request pays the fee asset to MixinFeeUserID
+// for the withdrawal transaction, the amount is not checked since the fee may change
+func verifySafeWithdrawalFeeRequest(request *SafeTransactionRequest, feeAssetID string, withdrawalHash mixinnet.Hash) error {
+	tx, err := mixinnet.TransactionFromRaw(request.RawTransaction)
+	if err != nil {
+		return err
+	}
+
+	if asset := mixinnet.NewHash([]byte(feeAssetID)); tx.Asset != asset {
+		return fmt.Errorf("withdrawal fee %s: asset %s mismatch, expect %s", request.RequestID, tx.Asset, asset)
+	}
+
+	if !slices.Contains(tx.References, withdrawalHash) {
+		return fmt.Errorf("withdrawal fee %s: withdrawal %s not referenced", request.RequestID, withdrawalHash)
+	}
+
+	if len(request.Receivers) == 0 || !isSafeWithdrawalFeeReceiver(request.Receivers[0]) {
+		return fmt.Errorf("withdrawal fee %s: fee receiver mismatch", request.RequestID)
+	}
+
+	return nil
+}
+
+func isSafeWithdrawalFeeReceiver(receiver *SafeTransactionReceiver) bool {
+	return slices.Equal(receiver.Members, []string{MixinFeeUserID})
+}
+
+func pickWithdrawalFee(fees []*SafeWithdrawalFee, feeAssetID string) (*SafeWithdrawalFee, error) {
+	if len(fees) == 0 {
+		return nil, errors.New("no withdrawal fee available")
+	}
+
+	if feeAssetID == "" {
+		return fees[0], nil
+	}
+
+	for _, fee := range fees {
+		if fee.AssetID == feeAssetID {
+			return fee, nil
+		}
+	}
+
+	return nil, fmt.Errorf("fee asset %s not supported", feeAssetID)
+}
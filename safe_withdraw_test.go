@@ -0,0 +1,248 @@
+package mixin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fox-one/mixin-sdk-go/v2/mixinnet"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPickWithdrawalFee(t *testing.T) {
+	eth, usdt := newUUID(), newUUID()
+	fees := []*SafeWithdrawalFee{
+		{AssetID: eth, Amount: decimal.RequireFromString("0.001")},
+		{AssetID: usdt, Amount: decimal.NewFromInt(2)},
+	}
+
+	fee, err := pickWithdrawalFee(fees, "")
+	require.NoError(t, err)
+	assert.Equal(t, eth, fee.AssetID)
+
+	fee, err = pickWithdrawalFee(fees, usdt)
+	require.NoError(t, err)
+	assert.Equal(t, "2", fee.Amount.String())
+
+	_, err = pickWithdrawalFee(fees, newUUID())
+	assert.Error(t, err)
+
+	_, err = pickWithdrawalFee(nil, "")
+	assert.Error(t, err)
+}
+
+func TestNewWithdrawalOutput(t *testing.T) {
+	output := newWithdrawalOutput("0xabc", "memo", decimal.RequireFromString("1.5"))
+	assert.Equal(t, uint8(mixinnet.OutputTypeWithdrawalSubmit), output.Type)
+	assert.Equal(t, "1.50000000", output.Amount.String())
+	assert.Equal(t, "0xabc", output.Withdrawal.Address)
+	assert.Equal(t, "memo", output.Withdrawal.Tag)
+
+	requestID := newUUID()
+	assert.Equal(t, SafeWithdrawalFeeRequestID(requestID), uuidHash([]byte(requestID+":fee")))
+}
+
+// testSafeTransactionAPI serves the utxos, ghost keys and transaction requests of SafeWithdraw
+type testSafeTransactionAPI struct {
+	mu        sync.Mutex
+	fees      []*SafeWithdrawalFee
+	utxos     map[string][]*SafeUtxo
+	receivers map[mixinnet.Key]*SafeTransactionReceiver
+	requests  map[string]*SafeTransactionRequest
+	created   []string
+}
+
+func newTestSafeTransactionAPI(t *testing.T, clientID string, fees []*SafeWithdrawalFee, utxos ...*SafeUtxo) *testSafeTransactionAPI {
+	api := &testSafeTransactionAPI{
+		fees:      fees,
+		utxos:     make(map[string][]*SafeUtxo),
+		receivers: make(map[mixinnet.Key]*SafeTransactionReceiver),
+		requests:  make(map[string]*SafeTransactionRequest),
+	}
+
+	for _, utxo := range utxos {
+		utxo.TransactionHash = mixinnet.NewHash([]byte(utxo.OutputID))
+		utxo.KernelAssetID = mixinnet.NewHash([]byte(utxo.AssetID))
+		utxo.Receivers = []string{clientID}
+		utxo.ReceiversThreshold = 1
+		api.utxos[utxo.AssetID] = append(api.utxos[utxo.AssetID], utxo)
+	}
+
+	newTestAPIServer(t, api)
+	return api
+}
+
+func (api *testSafeTransactionAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	switch path := r.URL.Path; {
+	case strings.HasSuffix(path, "/fees"):
+		writeTestAPIData(w, api.fees)
+	case path == "/safe/outputs":
+		var utxos []*SafeUtxo
+		if r.URL.Query().Get("offset") == "" {
+			utxos = api.utxos[r.URL.Query().Get("asset")]
+		}
+		writeTestAPIData(w, utxos)
+	case path == "/safe/keys":
+		var body struct {
+			Keys []*GhostInput `json:"keys"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		keys := make([]*GhostKeys, len(body.Keys))
+		for i, input := range body.Keys {
+			keys[i] = &GhostKeys{Mask: mixinnet.GenerateKey(rand.Reader).Public()}
+			for range input.Receivers {
+				keys[i].Keys = append(keys[i].Keys, mixinnet.GenerateKey(rand.Reader).Public())
+			}
+			api.receivers[keys[i].Mask] = &SafeTransactionReceiver{Members: input.Receivers, Threshold: 1}
+		}
+		writeTestAPIData(w, keys)
+	case path == "/safe/transaction/requests", path == "/safe/transactions":
+		var inputs []*SafeTransactionRequestInput
+		_ = json.NewDecoder(r.Body).Decode(&inputs)
+
+		requests := make([]*SafeTransactionRequest, len(inputs))
+		for i, input := range inputs {
+			tx, _ := mixinnet.TransactionFromRaw(input.RawTransaction)
+			txHash, _ := tx.TransactionHash()
+			request := &SafeTransactionRequest{
+				RequestID:       input.RequestID,
+				TransactionHash: txHash.String(),
+				RawTransaction:  input.RawTransaction,
+				State:           SafeUtxoStateUnspent,
+			}
+
+			for range tx.Inputs {
+				request.Views = append(request.Views, mixinnet.GenerateKey(rand.Reader))
+			}
+
+			for _, output := range tx.Outputs {
+				if receiver, ok := api.receivers[output.Mask]; ok {
+					request.Receivers = append(request.Receivers, receiver)
+				}
+			}
+
+			if path == "/safe/transactions" {
+				request.State = SafeUtxoStateSigned
+			} else {
+				api.created = append(api.created, request.RequestID)
+			}
+
+			api.requests[request.RequestID] = request
+			requests[i] = request
+		}
+		writeTestAPIData(w, requests)
+	case strings.HasPrefix(path, "/safe/transactions/"):
+		if request, ok := api.requests[strings.TrimPrefix(path, "/safe/transactions/")]; ok {
+			writeTestAPIData(w, request)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": Error{Status: http.StatusAccepted, Code: EndpointNotFound, Description: "not found"},
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestSafeWithdraw(t *testing.T) {
+	ctx := context.Background()
+	c := NewFromAccessToken("token")
+	c.ClientID = newUUID()
+	spendKey := mixinnet.GenerateKey(rand.Reader)
+
+	ethUtxos, usdtUtxos := newTestUtxos(10), newTestUtxos(5)
+	eth, usdt := ethUtxos[0].AssetID, usdtUtxos[0].AssetID
+	fees := []*SafeWithdrawalFee{
+		{AssetID: eth, Amount: decimal.NewFromInt(1)},
+		{AssetID: usdt, Amount: decimal.NewFromInt(2)},
+	}
+
+	t.Run("fee paid by the asset", func(t *testing.T) {
+		api := newTestSafeTransactionAPI(t, c.ClientID, fees, ethUtxos[0])
+		requestID := newUUID()
+
+		requests, err := c.SafeWithdraw(ctx, eth, "0xabc", "", decimal.NewFromInt(3), "", requestID, spendKey)
+		require.NoError(t, err)
+		require.Len(t, requests, 1)
+		assert.Equal(t, SafeUtxoStateSigned, requests[0].State)
+
+		tx, err := mixinnet.TransactionFromRaw(requests[0].RawTransaction)
+		require.NoError(t, err)
+		require.Len(t, tx.Outputs, 3, "withdrawal, fee and change")
+		assert.Equal(t, uint8(mixinnet.OutputTypeWithdrawalSubmit), tx.Outputs[0].Type)
+		assert.Equal(t, "0xabc", tx.Outputs[0].Withdrawal.Address)
+		assert.Equal(t, "3.00000000", tx.Outputs[0].Amount.String())
+		assert.Equal(t, "1.00000000", tx.Outputs[1].Amount.String())
+		assert.Equal(t, "6.00000000", tx.Outputs[2].Amount.String())
+		require.Len(t, requests[0].Receivers, 2)
+		assert.True(t, isSafeWithdrawalFeeReceiver(requests[0].Receivers[0]))
+		assert.Equal(t, []string{c.ClientID}, requests[0].Receivers[1].Members)
+
+		_, err = c.SafeWithdraw(ctx, eth, "0xabc", "", decimal.NewFromInt(3), "", requestID, spendKey)
+		require.NoError(t, err)
+		assert.Len(t, api.created, 1, "resumed")
+
+		_, err = c.SafeWithdraw(ctx, eth, "0xabc", "", decimal.NewFromInt(4), "", requestID, spendKey)
+		assert.Error(t, err, "amount mismatch")
+
+		_, err = c.SafeWithdraw(ctx, eth, "0xdef", "", decimal.NewFromInt(3), "", requestID, spendKey)
+		assert.Error(t, err, "destination mismatch")
+
+		_, err = c.SafeWithdraw(ctx, eth, "0xabc", "", decimal.NewFromInt(3), usdt, requestID, spendKey)
+		assert.Error(t, err, "fee already paid by the asset")
+	})
+
+	t.Run("fee paid by another asset", func(t *testing.T) {
+		api := newTestSafeTransactionAPI(t, c.ClientID, fees, ethUtxos[0], usdtUtxos[0])
+		requestID := newUUID()
+		feeRequestID := SafeWithdrawalFeeRequestID(requestID)
+
+		requests, err := c.SafeWithdraw(ctx, eth, "0xabc", "tag", decimal.NewFromInt(3), usdt, requestID, spendKey)
+		require.NoError(t, err)
+		require.Len(t, requests, 2)
+		assert.Equal(t, []string{requestID, feeRequestID}, api.created)
+
+		tx, err := mixinnet.TransactionFromRaw(requests[0].RawTransaction)
+		require.NoError(t, err)
+		require.Len(t, tx.Outputs, 2, "withdrawal and change")
+		assert.Equal(t, "tag", tx.Outputs[0].Withdrawal.Tag)
+		assert.Equal(t, "7.00000000", tx.Outputs[1].Amount.String())
+
+		feeTx, err := mixinnet.TransactionFromRaw(requests[1].RawTransaction)
+		require.NoError(t, err)
+		txHash, err := tx.TransactionHash()
+		require.NoError(t, err)
+		assert.Equal(t, []mixinnet.Hash{txHash}, feeTx.References)
+		assert.Equal(t, mixinnet.NewHash([]byte(usdt)), feeTx.Asset)
+		assert.Equal(t, "2.00000000", feeTx.Outputs[0].Amount.String())
+		assert.True(t, isSafeWithdrawalFeeReceiver(requests[1].Receivers[0]))
+
+		// the fee request is created again if it is missing
+		delete(api.requests, feeRequestID)
+		requests, err = c.SafeWithdraw(ctx, eth, "0xabc", "tag", decimal.NewFromInt(3), usdt, requestID, spendKey)
+		require.NoError(t, err)
+		require.Len(t, requests, 2)
+		assert.Equal(t, []string{requestID, feeRequestID, feeRequestID}, api.created)
+
+		feeTx, err = mixinnet.TransactionFromRaw(requests[1].RawTransaction)
+		require.NoError(t, err)
+		assert.Equal(t, []mixinnet.Hash{txHash}, feeTx.References)
+
+		_, err = c.SafeWithdraw(ctx, eth, "0xabc", "tag", decimal.NewFromInt(3), eth, requestID, spendKey)
+		assert.Error(t, err, "fee not paid by the asset")
+	})
+
+	_, err := c.SafeWithdraw(ctx, eth, "0xabc", "", decimal.NewFromInt(3), "", "withdraw-1", spendKey)
+	assert.Error(t, err, "request id must be uuid")
+}
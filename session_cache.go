@@ -0,0 +1,103 @@
+package mixin
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SessionCache caches the sessions of users for encrypting messages
+type SessionCache struct {
+	ttl     time.Duration
+	mux     sync.Mutex
+	entries map[string]sessionCacheEntry
+}
+
+type sessionCacheEntry struct {
+	sessions  []*Session
+	expiredAt time.Time
+}
+
+// NewSessionCache returns a SessionCache, sessions are fetched again after ttl, default 10 minutes
+func NewSessionCache(ttl time.Duration) *SessionCache {
+	if ttl <= 0 {
+		ttl = 10 * time.Minute
+	}
+
+	return &SessionCache{
+		ttl:     ttl,
+		entries: map[string]sessionCacheEntry{},
+	}
+}
+
+// Get returns the cached sessions of the user, ok is false if not cached or expired
+func (s *SessionCache) Get(userID string) ([]*Session, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	entry, ok := s.entries[userID]
+	if !ok || time.Now().After(entry.expiredAt) {
+		return nil, false
+	}
+
+	return entry.sessions, true
+}
+
+// Set replaces the sessions of the user
+func (s *SessionCache) Set(userID string, sessions []*Session) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.entries[userID] = sessionCacheEntry{
+		sessions:  sessions,
+		expiredAt: time.Now().Add(s.ttl),
+	}
+}
+
+func (s *SessionCache) Delete(userID string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	delete(s.entries, userID)
+}
+
+// Fetch returns the sessions of the users, the missing ones are fetched and cached
+func (s *SessionCache) Fetch(ctx context.Context, c *Client, userIDs []string) (map[string][]*Session, error) {
+	results := make(map[string][]*Session, len(userIDs))
+
+	var missing []string
+	for _, id := range userIDs {
+		if _, ok := results[id]; ok {
+			continue
+		}
+
+		if sessions, ok := s.Get(id); ok {
+			results[id] = sessions
+			continue
+		}
+
+		// placeholder to dedupe the ids
+		results[id] = nil
+		missing = append(missing, id)
+	}
+
+	if len(missing) == 0 {
+		return results, nil
+	}
+
+	sessions, err := c.FetchSessions(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		results[session.UserID] = append(results[session.UserID], session)
+	}
+
+	// users without any session are cached too, their messages are sent plain
+	for _, id := range missing {
+		s.Set(id, results[id])
+	}
+
+	return results, nil
+}
@@ -0,0 +1,171 @@
+package mixin
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionCache(t *testing.T) {
+	cache := NewSessionCache(50 * time.Millisecond)
+	userID := newUUID()
+
+	_, ok := cache.Get(userID)
+	assert.False(t, ok)
+
+	cache.Set(userID, []*Session{{UserID: userID, SessionID: newUUID()}})
+	sessions, ok := cache.Get(userID)
+	assert.True(t, ok)
+	assert.Len(t, sessions, 1)
+
+	time.Sleep(60 * time.Millisecond)
+	_, ok = cache.Get(userID)
+	assert.False(t, ok, "expired")
+
+	cache.Set(userID, nil)
+	sessions, ok = cache.Get(userID)
+	assert.True(t, ok, "users without sessions are cached")
+	assert.Empty(t, sessions)
+
+	cache.Delete(userID)
+	_, ok = cache.Get(userID)
+	assert.False(t, ok)
+}
+
+func TestCanEncryptMessage(t *testing.T) {
+	assert.True(t, canEncryptMessage(&MessageRequest{RecipientID: newUUID(), Category: MessageCategoryPlainText}))
+	assert.False(t, canEncryptMessage(&MessageRequest{Category: MessageCategoryPlainText}), "group message")
+	assert.False(t, canEncryptMessage(&MessageRequest{RecipientID: newUUID(), Category: MessageCategoryAppCard}))
+}
+
+type testMessageLocker struct{}
+
+func (testMessageLocker) Lock(data []byte, _ []*Session) ([]byte, error) {
+	return append([]byte("locked:"), data...), nil
+}
+
+func (testMessageLocker) Unlock(data []byte) ([]byte, error) {
+	return bytes.TrimPrefix(data, []byte("locked:")), nil
+}
+
+func TestSendMessagesE2E(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(newUUID())
+	c.MessageLocker = testMessageLocker{}
+
+	encryptedUser, plainUser := newUUID(), newUUID()
+	cache := NewSessionCache(time.Minute)
+	cache.Set(encryptedUser, []*Session{{UserID: encryptedUser, SessionID: newUUID(), PublicKey: "stale"}})
+	cache.Set(plainUser, nil)
+
+	newText := func(recipientID string, opts ...MessageOption) *MessageRequest {
+		msg, err := NewTextMessage(recipientID, "hello", opts...)
+		require.NoError(t, err)
+		return msg
+	}
+
+	messages := []*MessageRequest{
+		newText(encryptedUser),
+		newText(encryptedUser),
+		newText(plainUser),
+		newText(plainUser, WithConversation(newUUID())),
+	}
+
+	fresh := []*Session{{UserID: encryptedUser, SessionID: newUUID(), PublicKey: "fresh"}}
+
+	var (
+		encryptedCalls [][]*MessageRequest
+		plainSent      []*MessageRequest
+	)
+
+	s := c.newE2ESender(cache)
+	s.sendPlain = func(_ context.Context, messages []*MessageRequest) error {
+		plainSent = append(plainSent, messages...)
+		return nil
+	}
+	s.sendEncrypted = func(_ context.Context, messages []*MessageRequest) ([]*EncryptedMessageReceipt, error) {
+		encryptedCalls = append(encryptedCalls, messages)
+		var receipts []*EncryptedMessageReceipt
+		for i, msg := range messages {
+			state := EncryptedMessageReceiptStateSuccess
+			// the second message fails with the stale session at the first time
+			if len(encryptedCalls) == 1 && i == 1 {
+				state = EncryptedMessageReceiptStateFailed
+			}
+
+			receipts = append(receipts, &EncryptedMessageReceipt{
+				MessageID:   msg.MessageID,
+				RecipientID: msg.RecipientID,
+				State:       state,
+				Sessions:    fresh,
+			})
+		}
+
+		return receipts, nil
+	}
+
+	require.NoError(t, s.send(ctx, messages))
+
+	require.Len(t, encryptedCalls, 2)
+	assert.Len(t, encryptedCalls[0], 2)
+	require.Len(t, encryptedCalls[1], 1, "only the failed message is resent")
+	resent := encryptedCalls[1][0]
+	assert.Equal(t, messages[1].MessageID, resent.MessageID)
+	assert.Equal(t, EncryptMessageCategory(MessageCategoryPlainText), resent.Category)
+	assert.Equal(t, GenerateSessionChecksum(fresh), resent.Checksum)
+	assert.Len(t, resent.RecipientSessions, 1)
+	assert.Equal(t, MessageCategoryPlainText, messages[1].Category, "messages not modified")
+
+	sessions, _ := cache.Get(encryptedUser)
+	assert.Equal(t, fresh, sessions, "cache refreshed")
+
+	assert.Equal(t, []*MessageRequest{messages[2], messages[3]}, plainSent)
+
+	t.Run("retries exceeded", func(t *testing.T) {
+		plainSent = nil
+		s.sendEncrypted = func(_ context.Context, messages []*MessageRequest) ([]*EncryptedMessageReceipt, error) {
+			return []*EncryptedMessageReceipt{{
+				MessageID:   messages[0].MessageID,
+				RecipientID: encryptedUser,
+				State:       EncryptedMessageReceiptStateFailed,
+				Sessions:    fresh,
+			}}, nil
+		}
+
+		err := s.send(ctx, []*MessageRequest{newText(encryptedUser), newText(plainUser)})
+		assert.Error(t, err)
+		assert.Len(t, plainSent, 1, "plain messages still sent")
+	})
+
+	t.Run("batches", func(t *testing.T) {
+		var encryptedSizes, plainSizes []int
+		s.sendPlain = func(_ context.Context, messages []*MessageRequest) error {
+			plainSizes = append(plainSizes, len(messages))
+			return nil
+		}
+		s.sendEncrypted = func(_ context.Context, messages []*MessageRequest) ([]*EncryptedMessageReceipt, error) {
+			encryptedSizes = append(encryptedSizes, len(messages))
+			return nil, nil
+		}
+
+		var batch []*MessageRequest
+		for i := 0; i < 150; i++ {
+			batch = append(batch, newText(encryptedUser))
+		}
+		for i := 0; i < 250; i++ {
+			batch = append(batch, newText(plainUser))
+		}
+
+		require.NoError(t, s.send(ctx, batch))
+		assert.Equal(t, []int{100, 50}, encryptedSizes)
+		assert.Equal(t, []int{100, 100, 50}, plainSizes)
+	})
+
+	t.Run("nil cache", func(t *testing.T) {
+		assert.NotNil(t, c.newE2ESender(nil).cache)
+	})
+}